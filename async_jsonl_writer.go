@@ -0,0 +1,225 @@
+package jsplit
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// DefaultWriterQueueSize is the number of batches of items which may be queued for each list before parsing blocks
+	DefaultWriterQueueSize = 16
+	// writerBatchSize is the number of bytes of items collected before a batch is queued to be written
+	writerBatchSize = 64 * 1024
+)
+
+var errWriterClosed = errors.New("write to a closed writer")
+
+// itemBatch holds items queued to be written.  The items are stored back to back in data, and ends holds the offset of
+// the end of each item.
+type itemBatch struct {
+	data []byte
+	ends []int
+	// last is set on the final batch sent to a writer, after which the writer is closed
+	last bool
+}
+
+var batchPool = sync.Pool{
+	New: func() interface{} {
+		return &itemBatch{data: make([]byte, 0, writerBatchSize)}
+	},
+}
+
+// WriterPool writes the items queued by AsyncJsonlWriters using a fixed number of goroutines.  The items of each writer
+// are written in order by one goroutine at a time, while the items of different writers are written concurrently.
+type WriterPool struct {
+	ready chan *AsyncJsonlWriter
+	wg    sync.WaitGroup
+}
+
+// NewWriterPool returns a *WriterPool which writes using the supplied number of goroutines.  Close must be called to
+// stop the goroutines once all of the pool's writers have been closed.
+func NewWriterPool(goroutines int) *WriterPool {
+	if goroutines < 1 {
+		goroutines = 1
+	}
+
+	wp := &WriterPool{ready: make(chan *AsyncJsonlWriter, goroutines)}
+	wp.wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer wp.wg.Done()
+			for aw := range wp.ready {
+				aw.process()
+			}
+		}()
+	}
+
+	return wp
+}
+
+// Close stops the pool's goroutines once they have finished the work already queued. Items queued by writers which
+// have not been closed may not be written.
+func (wp *WriterPool) Close() {
+	close(wp.ready)
+	wp.wg.Wait()
+}
+
+// AsyncJsonlWriter queues items to be written to a SplittingJsonlWriter by the goroutines of a WriterPool, so that
+// parsing can continue while the items are written and compressed.  Items are copied into batches, and the number of
+// batches which may be queued is bounded so that parsing blocks when writing falls behind.
+type AsyncJsonlWriter struct {
+	pool  *WriterPool
+	wr    *SplittingJsonlWriter
+	queue chan *itemBatch
+	batch *itemBatch
+
+	// scheduled is 1 while the writer has been handed to the pool to process its queue
+	scheduled int32
+	closed    bool
+	done      chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewAsyncJsonlWriter returns an *AsyncJsonlWriter which writes to wr using the goroutines of the supplied pool.  Up to
+// queueSize batches of items are queued before Add blocks.
+func NewAsyncJsonlWriter(pool *WriterPool, wr *SplittingJsonlWriter, queueSize int) *AsyncJsonlWriter {
+	if queueSize < 1 {
+		queueSize = DefaultWriterQueueSize
+	}
+
+	return &AsyncJsonlWriter{
+		pool:  pool,
+		wr:    wr,
+		queue: make(chan *itemBatch, queueSize),
+		done:  make(chan struct{}),
+	}
+}
+
+// Add copies an item to be written.  It may return an error encountered while writing earlier items, in which case no
+// more items will be written.
+func (aw *AsyncJsonlWriter) Add(item []byte) error {
+	if aw.closed {
+		return errWriterClosed
+	}
+
+	if aw.batch == nil {
+		aw.batch = batchPool.Get().(*itemBatch)
+	}
+
+	aw.batch.data = append(aw.batch.data, item...)
+	aw.batch.ends = append(aw.batch.ends, len(aw.batch.data))
+
+	if len(aw.batch.data) >= writerBatchSize {
+		aw.send(aw.batch)
+		aw.batch = nil
+
+		// errors are only checked as batches are sent to avoid taking the lock for every item
+		return aw.getErr()
+	}
+
+	return nil
+}
+
+// Close waits for the queued items to be written and closes the underlying SplittingJsonlWriter, returning the first
+// error encountered
+func (aw *AsyncJsonlWriter) Close() error {
+	if aw.closed {
+		return aw.getErr()
+	}
+
+	aw.closed = true
+	batch := aw.batch
+	if batch == nil {
+		batch = batchPool.Get().(*itemBatch)
+	}
+
+	aw.batch = nil
+	batch.last = true
+	aw.send(batch)
+
+	<-aw.done
+	return aw.getErr()
+}
+
+// send queues a batch, blocking while the queue is full, and hands the writer to the pool if it isn't already waiting
+// to be processed
+func (aw *AsyncJsonlWriter) send(batch *itemBatch) {
+	aw.queue <- batch
+	aw.schedule()
+}
+
+func (aw *AsyncJsonlWriter) schedule() {
+	if atomic.CompareAndSwapInt32(&aw.scheduled, 0, 1) {
+		aw.pool.ready <- aw
+	}
+}
+
+// process writes queued batches until the queue is empty. It is run by one of the pool's goroutines.
+func (aw *AsyncJsonlWriter) process() {
+	for {
+		select {
+		case batch := <-aw.queue:
+			aw.write(batch)
+
+		default:
+			atomic.StoreInt32(&aw.scheduled, 0)
+
+			// a batch may have been queued after the queue was found to be empty but before the writer was marked as
+			// unscheduled, in which case the sender will not have scheduled it again
+			if len(aw.queue) == 0 || !atomic.CompareAndSwapInt32(&aw.scheduled, 0, 1) {
+				return
+			}
+		}
+	}
+}
+
+// write writes the items of a batch, closing the SplittingJsonlWriter after the last batch
+func (aw *AsyncJsonlWriter) write(batch *itemBatch) {
+	if aw.getErr() == nil {
+		start := 0
+		for _, end := range batch.ends {
+			err := aw.wr.Add(batch.data[start:end])
+			if err != nil {
+				aw.setErr(err)
+				break
+			}
+
+			start = end
+		}
+	}
+
+	last := batch.last
+	if cap(batch.data) <= 4*writerBatchSize {
+		// batches which grew to hold a very large item are left for the garbage collector rather than being pooled
+		batch.data = batch.data[:0]
+		batch.ends = batch.ends[:0]
+		batch.last = false
+		batchPool.Put(batch)
+	}
+
+	if last {
+		err := aw.wr.Close()
+		if err != nil {
+			aw.setErr(err)
+		}
+
+		close(aw.done)
+	}
+}
+
+func (aw *AsyncJsonlWriter) getErr() error {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	return aw.err
+}
+
+func (aw *AsyncJsonlWriter) setErr(err error) {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if aw.err == nil {
+		aw.err = err
+	}
+}
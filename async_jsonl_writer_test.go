@@ -0,0 +1,100 @@
+package jsplit
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncJsonlWriter(t *testing.T) {
+	const writers = 5
+	const numItems = 20000
+
+	pool := NewWriterPool(3)
+	defer pool.Close()
+
+	var mu sync.Mutex
+	buffers := make([][]*BufWriteCloser, writers)
+	asyncWriters := make([]*AsyncJsonlWriter, writers)
+	for i := 0; i < writers; i++ {
+		i := i
+		createWriter := func() (io.WriteCloser, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			buf := NewBufWriteCloser()
+			buffers[i] = append(buffers[i], buf)
+			return buf, nil
+		}
+
+		wr := NewSplittingJsonlWriterWithThreshold(createWriter, SplitThreshold{Items: 1000})
+		asyncWriters[i] = NewAsyncJsonlWriter(pool, wr, 2)
+	}
+
+	// interleave the items of each writer so that they are written concurrently
+	for j := 0; j < numItems; j++ {
+		for i, aw := range asyncWriters {
+			err := aw.Add([]byte(fmt.Sprintf(`{"writer":%d,"item":%d}`, i, j)))
+			require.NoError(t, err)
+		}
+	}
+
+	for _, aw := range asyncWriters {
+		require.NoError(t, aw.Close())
+	}
+
+	for i := 0; i < writers; i++ {
+		require.Len(t, buffers[i], numItems/1000)
+
+		for file, buf := range buffers[i] {
+			lines := strings.Split(buf.String(), "\n")
+			require.Len(t, lines, 1000)
+			for j, line := range lines {
+				require.Equal(t, fmt.Sprintf(`{"writer":%d,"item":%d}`, i, file*1000+j), line)
+			}
+		}
+	}
+}
+
+func TestAsyncJsonlWriterError(t *testing.T) {
+	pool := NewWriterPool(1)
+	defer pool.Close()
+
+	expectedErr := errors.New("create failed")
+	createWriter := func() (io.WriteCloser, error) {
+		return nil, expectedErr
+	}
+
+	aw := NewAsyncJsonlWriter(pool, NewSplittingJsonlWriter(createWriter, 0), 1)
+
+	// the error is returned by Add once it has been found by the writing goroutine
+	item := []byte(strings.Repeat("x", writerBatchSize))
+	var err error
+	for i := 0; i < 4 && err == nil; i++ {
+		err = aw.Add(item)
+	}
+
+	require.Equal(t, expectedErr, aw.Close())
+	require.Equal(t, expectedErr, aw.Close())
+	require.Equal(t, errWriterClosed, aw.Add(item))
+}
+
+func TestAsyncJsonlWriterNoItems(t *testing.T) {
+	pool := NewWriterPool(2)
+	defer pool.Close()
+
+	created := 0
+	createWriter := func() (io.WriteCloser, error) {
+		created++
+		return NewBufWriteCloser(), nil
+	}
+
+	aw := NewAsyncJsonlWriter(pool, NewSplittingJsonlWriter(createWriter, 0), 0)
+	require.NoError(t, aw.Close())
+	require.Equal(t, 0, created)
+}
@@ -1,59 +1,157 @@
-package main
+package jsplit
 
 import (
-	"compress/gzip"
+	"bufio"
 	"context"
 	"io"
 	"os"
-	"strings"
 	"sync/atomic"
 )
 
 // AsyncReader reads an io.Reader asynchronously
 type AsyncReader struct {
-	readCh     chan []byte
-	rd         io.Reader
-	bufferSize int
-	isClosed   int32
+	readCh      chan []byte
+	rd          io.Reader
+	compression Compression
+	encoding    Encoding
+	bufferSize  int
+	// free holds buffers returned by Recycle to be reused for later reads
+	free chan []byte
+	// progress counts the bytes read when the progress of a split is reported
+	progress *progress
+	isClosed int32
+	done     chan struct{}
 }
 
 // AsyncReaderFromFile creates an AsyncReader for reading the specified file
 func AsyncReaderFromFile(filename string, bufferSize int) (*AsyncReader, error) {
+	rd, err := OpenFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return AsyncReaderFromReaderWithCompression(rd, bufferSize, CompressionNone)
+}
+
+// OpenFile opens the specified file for reading.  If the file is compressed the returned io.ReadCloser will read the
+// decompressed data, otherwise it is the *os.File itself.  Closing the returned io.ReadCloser closes the underlying file.
+func OpenFile(filename string) (io.ReadCloser, error) {
+	return OpenFileWithCompression(filename, CompressionAuto)
+}
+
+// OpenFileWithCompression opens the specified file for reading, decompressing it using the supplied compression format.
+// When the file is not compressed the *os.File itself is returned, so it can be split in parallel and its size is known.
+// Closing the returned io.ReadCloser closes the underlying file.
+func OpenFileWithCompression(filename string, c Compression) (io.ReadCloser, error) {
 	f, err := os.OpenFile(filename, os.O_RDONLY, os.ModePerm)
 	if err != nil {
 		return nil, err
 	}
 
-	// if gzipped, wrap in gzip reader
-	if strings.HasSuffix(filename, ".gz") {
-		gr, err := gzip.NewReader(f)
+	var rd io.Reader = f
+	if c == "" || c == CompressionAuto {
+		br := bufio.NewReader(f)
+		c, err = DetectCompression(br)
 		if err != nil {
+			f.Close()
 			return nil, err
 		}
 
-		return AsyncReaderFromReader(gr, bufferSize)
+		// the file is read again from its start. Files which can't seek, such as named pipes, are read from the bytes
+		// buffered while detecting the compression.
+		if _, err = f.Seek(0, io.SeekStart); err != nil {
+			rd = br
+		}
+	}
+
+	if c == CompressionNone {
+		if _, ok := rd.(*os.File); ok {
+			return f, nil
+		}
+
+		return &wrappedReadCloser{Reader: rd, closers: []io.Closer{f}}, nil
+	}
+
+	dr, err := NewDecompressingReader(rd, c)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &wrappedReadCloser{Reader: dr, closers: []io.Closer{dr, f}}, nil
+}
+
+// wrappedReadCloser reads from a reader which wraps one or more io.Closer instances that need to be closed when reading
+// is complete
+type wrappedReadCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close closes each of the wrapped io.Closer instances returning the first error encountered
+func (wrc *wrappedReadCloser) Close() error {
+	var firstErr error
+	for _, c := range wrc.closers {
+		err := c.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
 
-	return AsyncReaderFromReader(f, bufferSize)
+	return firstErr
 }
 
-// AsyncReaderFromReader returns an AsyncReader for reading the supplied io.Reader
+// AsyncReaderFromReader returns an AsyncReader for reading the supplied io.Reader.  If the data read from rd is
+// compressed, the AsyncReader will return the decompressed data.  UTF-16 and UTF-32 data is converted to UTF-8 and
+// byte order marks are removed.
 func AsyncReaderFromReader(rd io.Reader, bufferSize int) (*AsyncReader, error) {
+	return AsyncReaderFromReaderWithCompression(rd, bufferSize, CompressionAuto)
+}
+
+// AsyncReaderFromReaderWithCompression returns an AsyncReader for reading the supplied io.Reader, decompressing it
+// using the supplied compression format
+func AsyncReaderFromReaderWithCompression(rd io.Reader, bufferSize int, c Compression) (*AsyncReader, error) {
+	return AsyncReaderFromReaderWithEncoding(rd, bufferSize, c, EncodingAuto)
+}
+
+// AsyncReaderFromReaderWithEncoding returns an AsyncReader for reading the supplied io.Reader, decompressing it using
+// the supplied compression format and converting the decompressed data from the supplied encoding to UTF-8
+func AsyncReaderFromReaderWithEncoding(rd io.Reader, bufferSize int, c Compression, e Encoding) (*AsyncReader, error) {
 	return &AsyncReader{
-		readCh:     make(chan []byte, 16),
-		rd:         rd,
-		bufferSize: bufferSize,
+		readCh:      make(chan []byte, 16),
+		rd:          rd,
+		compression: c,
+		encoding:    e,
+		bufferSize:  bufferSize,
+		free:        make(chan []byte, 16),
+		done:        make(chan struct{}),
 	}, nil
 }
 
-// Start starts the background reading of the io.Reader
+// Start starts the background reading of the io.Reader.  Reading stops when the io.Reader is exhausted, a read error
+// occurs, or the supplied context is cancelled.
 func (afr *AsyncReader) Start(ctx context.Context) context.Context {
 	errCtx, cancelFunc := NewErrContextWithCancel(ctx)
 
 	go func() {
+		defer close(afr.done)
+
+		dr, err := NewDecompressingReader(afr.progress.inputReader(afr.rd), afr.compression)
+		if err != nil {
+			cancelFunc(err)
+			return
+		}
+		defer dr.Close()
+
+		rd, err := NewTranscodingReader(dr, afr.encoding)
+		if err != nil {
+			cancelFunc(err)
+			return
+		}
+
 		for {
-			buf := make([]byte, afr.bufferSize)
-			n, err := afr.rd.Read(buf)
+			buf := afr.buffer()
+			n, err := rd.Read(buf)
 
 			if err != nil && err != io.EOF {
 				cancelFunc(err)
@@ -61,7 +159,12 @@ func (afr *AsyncReader) Start(ctx context.Context) context.Context {
 			}
 
 			if n > 0 {
-				afr.readCh <- buf[:n]
+				afr.progress.addDecoded(n)
+				select {
+				case afr.readCh <- buf[:n]:
+				case <-errCtx.Done():
+					return
+				}
 			}
 
 			if err == io.EOF {
@@ -75,6 +178,28 @@ func (afr *AsyncReader) Start(ctx context.Context) context.Context {
 	return errCtx
 }
 
+// buffer returns a recycled buffer if one is available, otherwise a new one
+func (afr *AsyncReader) buffer() []byte {
+	select {
+	case buf := <-afr.free:
+		return buf[:afr.bufferSize]
+	default:
+		return make([]byte, afr.bufferSize)
+	}
+}
+
+// Recycle returns a chunk returned by Read once it is no longer in use, so its memory can be reused by a later read
+func (afr *AsyncReader) Recycle(chunk []byte) {
+	if cap(chunk) != afr.bufferSize {
+		return
+	}
+
+	select {
+	case afr.free <- chunk:
+	default:
+	}
+}
+
 // Read gets the next chunk which has been read from the file.
 func (afr *AsyncReader) Read(ctx context.Context) ([]byte, error) {
 	select {
@@ -90,6 +215,13 @@ func (afr *AsyncReader) Read(ctx context.Context) ([]byte, error) {
 	}
 }
 
+// Wait blocks until the background reading started by Start has stopped.  Once Wait returns the underlying io.Reader
+// is no longer in use, except by a read of gzip input which was still in progress, as described by
+// NewParallelGzipReader.
+func (afr *AsyncReader) Wait() {
+	<-afr.done
+}
+
 // IsClosed is used for testing to verify that the reader and associated channel has been closed.
 func (afr *AsyncReader) IsClosed() bool {
 	return atomic.LoadInt32(&afr.isClosed) == 1
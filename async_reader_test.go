@@ -1,4 +1,4 @@
-package main
+package jsplit
 
 import (
 	"bytes"
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"io"
 	"math/rand"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -50,7 +51,8 @@ func TestAsyncReaderReadsAll(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			ctx := context.Background()
 			testBuffer := buffer[:test.size]
-			rd, err := AsyncReaderFromReader(bytes.NewReader(testBuffer), test.bufferSize)
+			// random data could be mistaken for compressed or UTF-16 data so it is read as is
+			rd, err := AsyncReaderFromReaderWithEncoding(bytes.NewReader(testBuffer), test.bufferSize, CompressionNone, EncodingUTF8)
 			require.NoError(t, err)
 			ctx = rd.Start(ctx)
 
@@ -64,6 +66,8 @@ func TestAsyncReaderReadsAll(t *testing.T) {
 				require.NoError(t, err)
 
 				read = append(read, newlyRead...)
+				// recycled chunks are reused by later reads, which must not affect the data already read
+				rd.Recycle(newlyRead)
 			}
 
 			require.Equal(t, read, testBuffer)
@@ -106,11 +110,13 @@ func TestReadError(t *testing.T) {
 		errAfterNReads: errAfterNReads,
 	}
 
-	rd, err := AsyncReaderFromReader(er, 32)
+	// the random data is neither compressed nor transcoded so that each read of er produces a single chunk
+	rd, err := AsyncReaderFromReaderWithEncoding(er, 32, CompressionNone, EncodingUTF8)
 	require.NoError(t, err)
 	ctx := rd.Start(context.Background())
 
-	for i := 0; i < errAfterNReads; i++ {
+	// the reads which succeed may be buffered, so read until the error is surfaced
+	for i := 0; i <= errAfterNReads; i++ {
 		_, err = rd.Read(ctx)
 		if err != nil {
 			break
@@ -119,3 +125,111 @@ func TestReadError(t *testing.T) {
 
 	require.Equal(t, err, expectedErr)
 }
+
+func TestAsyncReaderDecompresses(t *testing.T) {
+	rd, err := AsyncReaderFromReader(bytes.NewReader(compressTestDoc(t, CompressionGzip)), 4)
+	require.NoError(t, err)
+	ctx := rd.Start(context.Background())
+
+	var read []byte
+	for {
+		newlyRead, err := rd.Read(ctx)
+		if err == io.EOF {
+			break
+		}
+
+		require.NoError(t, err)
+		read = append(read, newlyRead...)
+	}
+
+	require.Equal(t, compressionTestDoc, string(read))
+}
+
+// BenchmarkAsyncReaderParseList parses lists read through an AsyncReader, covering items much smaller than the read
+// buffer and items spanning several reads
+func BenchmarkAsyncReaderParseList(b *testing.B) {
+	list := func(items int, item func(i int) string) []byte {
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i := 0; i < items; i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(item(i))
+		}
+		buf.WriteByte(']')
+		return buf.Bytes()
+	}
+
+	benchmarks := []struct {
+		name string
+		doc  []byte
+	}{
+		{
+			name: "small items",
+			doc: list(500000, func(i int) string {
+				return `{"id": ` + strconv.Itoa(i) + `, "name": "item ` + strconv.Itoa(i) + `", "tags": ["a", "b"]}`
+			}),
+		},
+		{
+			name: "large items",
+			doc: list(4, func(i int) string {
+				return `"` + string(bytes.Repeat([]byte{'a' + byte(i)}, 16*1024*1024)) + `"`
+			}),
+		},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.SetBytes(int64(len(bm.doc)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				rd, err := AsyncReaderFromReaderWithEncoding(bytes.NewReader(bm.doc), DefaultReadBufferSize, CompressionNone, EncodingUTF8)
+				require.NoError(b, err)
+
+				ctx := rd.Start(context.Background())
+				err = ParseList(NewBufferedStreamIter(rd, ctx), func(item []byte) error {
+					return nil
+				})
+				require.NoError(b, err)
+				rd.Wait()
+			}
+		})
+	}
+}
+
+func BenchmarkAsyncReader(b *testing.B) {
+	runShapeBenchmarks(b, func(b *testing.B, doc []byte) {
+		// decompression is measured against the size of the uncompressed document
+		for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+			var input bytes.Buffer
+			cw, err := NewCompressingWriter(&input, compression)
+			require.NoError(b, err)
+			_, err = cw.Write(doc)
+			require.NoError(b, err)
+			require.NoError(b, cw.Close())
+
+			b.Run(string(compression), func(b *testing.B) {
+				b.SetBytes(int64(len(doc)))
+				b.ReportAllocs()
+
+				for i := 0; i < b.N; i++ {
+					rd, err := AsyncReaderFromReader(bytes.NewReader(input.Bytes()), DefaultReadBufferSize)
+					require.NoError(b, err)
+
+					ctx := rd.Start(context.Background())
+					for {
+						chunk, err := rd.Read(ctx)
+						if err == io.EOF {
+							break
+						}
+
+						require.NoError(b, err)
+						rd.Recycle(chunk)
+					}
+				}
+			})
+		}
+	})
+}
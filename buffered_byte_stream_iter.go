@@ -1,6 +1,7 @@
-package main
+package jsplit
 
 import (
+	"bytes"
 	"context"
 	"io"
 )
@@ -10,13 +11,60 @@ type ByteStream interface {
 	Read(ctx context.Context) ([]byte, error)
 }
 
-// BufferedByteStreamIter attempts to efficiently buffer a stream of bytes to be iterated over sequentially
+// RecyclingByteStream is a ByteStream whose chunks can be reused once the iterator reading them has finished with them
+type RecyclingByteStream interface {
+	ByteStream
+	// Recycle returns a chunk previously returned by Read so that its memory can be reused by a later Read
+	Recycle(chunk []byte)
+}
+
+// maxRetired is the number of chunks held waiting for Release.  Chunks beyond this are left for the garbage collector so
+// iterators which are never released do not hold on to the whole stream.
+const maxRetired = 16
+
+// Position identifies a location within a byte stream
+type Position struct {
+	// Offset is the 0 based byte offset from the start of the stream
+	Offset int64
+	// Line is the 1 based line number
+	Line int
+	// Column is the 1 based byte offset from the start of the line
+	Column int
+}
+
+// BufferedByteStreamIter attempts to efficiently buffer a stream of bytes to be iterated over sequentially.  While the
+// unconsumed bytes lie within a single chunk of the stream the buffer is a slice of that chunk.  When a value spans
+// chunks it is joined in a scratch buffer which grows geometrically, so values spanning many chunks are copied a
+// constant number of times on average.
+//
+// Slices returned by Value refer to the chunks and scratch buffers of the iterator.  Once a caller has finished with
+// them it calls Release, allowing the memory the iterator has moved past to be reused.
 type BufferedByteStreamIter struct {
 	stream ByteStream
 	ctx    context.Context
 
 	buffer []byte
 	pos    int
+	// backing is the chunk or scratch buffer which buffer is a slice of, and inScratch is set when it is a scratch
+	// buffer
+	backing   []byte
+	inScratch bool
+	// retiredChunks and retiredScratch hold the memory the iterator has moved past which may still be referenced by
+	// slices returned from Value.  It is recycled by Release.
+	retiredChunks  [][]byte
+	retiredScratch [][]byte
+	freeScratch    []byte
+	// eof is set once the stream has been exhausted, distinguishing the 0 returned by Next at the end of the stream
+	// from a 0 byte within it
+	eof bool
+	// err is the error which ended the stream early, if reading it failed
+	err error
+
+	// offset is the position in the stream of the first byte of buffer.  line and lineStart are the line number of
+	// that byte and the offset at which its line starts.
+	offset    int64
+	line      int
+	lineStart int64
 }
 
 // NewBufferStreamIter returns a *BufferedByteStreamIter for iterating over the bytes of the given byte stream
@@ -26,17 +74,26 @@ func NewBufferedStreamIter(stream ByteStream, readCtx context.Context) *Buffered
 		buffer: nil,
 		pos:    0,
 		ctx:    readCtx,
+		line:   1,
 	}
 }
 
 // Next read the byte at the current position and move the current position forward.  When all bytes have been iterated
-// over a call to next will return 0
+// over a call to next will return 0.  If reading the stream fails Next also returns 0, as if the stream had ended, and
+// the error is returned by Err.
 func (itr *BufferedByteStreamIter) Next() byte {
 	if itr.pos >= len(itr.buffer) {
+		if itr.eof {
+			return 0
+		}
+
 		err := itr.readMore()
-		if err != nil && err != io.EOF {
-			panic(err)
-		} else if err == io.EOF {
+		if err != nil {
+			if err != io.EOF {
+				itr.err = err
+			}
+
+			itr.eof = true
 			return 0
 		}
 	}
@@ -47,10 +104,15 @@ func (itr *BufferedByteStreamIter) Next() byte {
 	return ch
 }
 
+// Err returns the error which ended the stream early, or nil if the stream has not failed
+func (itr *BufferedByteStreamIter) Err() error {
+	return itr.err
+}
+
 // Advance moves the current position forward n places for positive numbers, and back n places for negative numbers
 func (itr *BufferedByteStreamIter) Advance(n int) {
 	if n > 0 {
-		itr.buffer = itr.buffer[n:]
+		itr.discard(n)
 		itr.pos -= n
 	} else {
 		itr.pos += n
@@ -59,7 +121,7 @@ func (itr *BufferedByteStreamIter) Advance(n int) {
 
 // Skip moves the start of the buffer to the current position, and then sets the current position to 0
 func (itr *BufferedByteStreamIter) Skip() {
-	itr.buffer = itr.buffer[itr.pos:]
+	itr.discard(itr.pos)
 	itr.pos = 0
 }
 
@@ -67,11 +129,62 @@ func (itr *BufferedByteStreamIter) Skip() {
 // start of the buffer to be the current position, and then sets the current position to 0 and then returns
 func (itr *BufferedByteStreamIter) Value() []byte {
 	val := itr.buffer[:itr.pos]
-	itr.buffer = itr.buffer[itr.pos:]
+	itr.discard(itr.pos)
 	itr.pos = 0
 	return val
 }
 
+// Position returns the position in the stream of the byte at the current position, which is the byte that will be
+// returned by the next call to Next
+func (itr *BufferedByteStreamIter) Position() Position {
+	return itr.positionOf(itr.pos)
+}
+
+// positionOf returns the position in the stream of the byte at index i of the buffer
+func (itr *BufferedByteStreamIter) positionOf(i int) Position {
+	line, lineStart := itr.line, itr.lineStart
+	if prefix := itr.buffer[:i]; len(prefix) > 0 {
+		if lf := bytes.LastIndexByte(prefix, LF); lf != -1 {
+			line += bytes.Count(prefix, newLineBytes)
+			lineStart = itr.offset + int64(lf) + 1
+		}
+	}
+
+	offset := itr.offset + int64(i)
+	return Position{
+		Offset: offset,
+		Line:   line,
+		Column: int(offset-lineStart) + 1,
+	}
+}
+
+// surrounding returns up to n bytes either side of index i of the buffer.  Bytes which have already been discarded from
+// the buffer are not available.
+func (itr *BufferedByteStreamIter) surrounding(i, n int) []byte {
+	start, end := i-n, i+n
+	if start < 0 {
+		start = 0
+	}
+
+	if end > len(itr.buffer) {
+		end = len(itr.buffer)
+	}
+
+	return itr.buffer[start:end]
+}
+
+// discard removes the first n bytes from the buffer keeping track of the position in the stream
+func (itr *BufferedByteStreamIter) discard(n int) {
+	d := itr.buffer[:n]
+	if lf := bytes.LastIndexByte(d, LF); lf != -1 {
+		itr.line += bytes.Count(d, newLineBytes)
+		itr.lineStart = itr.offset + int64(lf) + 1
+	}
+
+	itr.offset += int64(n)
+	itr.buffer = itr.buffer[n:]
+}
+
 func (itr *BufferedByteStreamIter) readMore() error {
 	buf, err := itr.stream.Read(itr.ctx)
 	if err != nil {
@@ -79,16 +192,82 @@ func (itr *BufferedByteStreamIter) readMore() error {
 	}
 
 	if len(itr.buffer) == 0 {
+		itr.retireBacking()
 		itr.buffer = buf
+		itr.backing, itr.inScratch = buf, false
 		itr.pos = 0
+		return nil
+	}
+
+	// the unconsumed bytes are joined with the new chunk in a scratch buffer. Bytes are only ever appended to the
+	// scratch buffer in use, so slices already returned from it are not modified.
+	if itr.inScratch && cap(itr.buffer)-len(itr.buffer) >= len(buf) {
+		itr.buffer = append(itr.buffer, buf...)
 	} else {
-		oldLen := len(itr.buffer)
-		newBufferLen := oldLen + len(buf)
-		newBuf := make([]byte, newBufferLen)
-		copy(newBuf, itr.buffer)
-		copy(newBuf[oldLen:], buf)
-		itr.buffer = newBuf
+		scratch := itr.takeScratch(len(itr.buffer) + len(buf))
+		scratch = append(append(scratch, itr.buffer...), buf...)
+		itr.retireBacking()
+		itr.buffer = scratch
+		itr.backing, itr.inScratch = scratch, true
 	}
 
+	itr.retire(&itr.retiredChunks, buf)
 	return nil
 }
+
+// Release recycles the chunks and scratch buffers which the iterator has moved past.  Slices previously returned by
+// Value must not be used after Release is called.
+func (itr *BufferedByteStreamIter) Release() {
+	if len(itr.retiredChunks) == 0 && len(itr.retiredScratch) == 0 {
+		return
+	}
+
+	if rs, ok := itr.stream.(RecyclingByteStream); ok {
+		for _, chunk := range itr.retiredChunks {
+			rs.Recycle(chunk)
+		}
+	}
+
+	for _, scratch := range itr.retiredScratch {
+		if cap(scratch) > cap(itr.freeScratch) {
+			itr.freeScratch = scratch[:0]
+		}
+	}
+
+	clear(itr.retiredChunks)
+	clear(itr.retiredScratch)
+	itr.retiredChunks = itr.retiredChunks[:0]
+	itr.retiredScratch = itr.retiredScratch[:0]
+}
+
+// takeScratch returns an empty scratch buffer with capacity for at least n bytes
+func (itr *BufferedByteStreamIter) takeScratch(n int) []byte {
+	if cap(itr.freeScratch) >= n {
+		scratch := itr.freeScratch
+		itr.freeScratch = nil
+		return scratch
+	}
+
+	return make([]byte, 0, 2*n)
+}
+
+// retireBacking retires the chunk or scratch buffer the buffer currently refers to
+func (itr *BufferedByteStreamIter) retireBacking() {
+	if itr.backing == nil {
+		return
+	}
+
+	if itr.inScratch {
+		itr.retire(&itr.retiredScratch, itr.backing)
+	} else {
+		itr.retire(&itr.retiredChunks, itr.backing)
+	}
+
+	itr.backing = nil
+}
+
+func (itr *BufferedByteStreamIter) retire(retired *[][]byte, buf []byte) {
+	if len(*retired) < maxRetired {
+		*retired = append(*retired, buf)
+	}
+}
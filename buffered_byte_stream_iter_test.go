@@ -1,6 +1,7 @@
-package main
+package jsplit
 
 import (
+	"bytes"
 	"context"
 	"github.com/stretchr/testify/require"
 	"io"
@@ -65,3 +66,128 @@ func TestBufferedByteStreamIter(t *testing.T) {
 
 	require.Equal(t, splitWords, words)
 }
+
+func TestBufferedByteStreamIterPosition(t *testing.T) {
+	testStr := "ab\ncd\n\nefg"
+	tbs := NewTestByteStream([]byte(testStr), 3)
+	itr := NewBufferedStreamIter(tbs, context.Background())
+
+	expected := []Position{
+		{0, 1, 1}, {1, 1, 2}, {2, 1, 3},
+		{3, 2, 1}, {4, 2, 2}, {5, 2, 3},
+		{6, 3, 1},
+		{7, 4, 1}, {8, 4, 2}, {9, 4, 3},
+	}
+
+	for i := 0; i < len(testStr); i++ {
+		require.Equal(t, expected[i], itr.Position())
+		require.Equal(t, testStr[i], itr.Next())
+
+		// discarding bytes from the buffer must not affect the position
+		if i%2 == 0 {
+			itr.Skip()
+		} else if i%3 == 0 {
+			itr.Value()
+		}
+	}
+
+	require.Equal(t, Position{10, 4, 4}, itr.Position())
+}
+
+// BenchmarkBufferedByteStreamIterLargeValue iterates over a value which spans many chunks of the stream
+func BenchmarkBufferedByteStreamIterLargeValue(b *testing.B) {
+	const chunkSize = 64 * 1024
+	const valueSize = 16 * 1024 * 1024
+
+	data := bytes.Repeat([]byte{'a'}, valueSize)
+	b.SetBytes(valueSize)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		itr := NewBufferedStreamIter(NewTestByteStream(data, chunkSize), context.Background())
+		for itr.Next() != 0 {
+		}
+
+		if len(itr.Value()) != valueSize {
+			b.Fatal("value was not read")
+		}
+	}
+}
+
+// BenchmarkBufferedByteStreamIter iterates over each document a byte at a time, taking a value at each comma as the
+// parser does at the end of each list item
+func BenchmarkBufferedByteStreamIter(b *testing.B) {
+	runShapeBenchmarks(b, func(b *testing.B, doc []byte) {
+		for i := 0; i < b.N; i++ {
+			itr := NewBufferedStreamIter(NewTestByteStream(doc, DefaultReadBufferSize), context.Background())
+			for ch := itr.Next(); ch != 0; ch = itr.Next() {
+				if ch == COMMA {
+					itr.Value()
+					itr.Release()
+				}
+			}
+		}
+	})
+}
+
+// recyclingTestStream is a TestByteStream which records the chunks it is asked to recycle
+type recyclingTestStream struct {
+	*TestByteStream
+	recycled [][]byte
+}
+
+func (rs *recyclingTestStream) Recycle(chunk []byte) {
+	rs.recycled = append(rs.recycled, chunk)
+}
+
+func TestBufferedByteStreamIterRelease(t *testing.T) {
+	rs := &recyclingTestStream{TestByteStream: NewTestByteStream([]byte("abcdefghijklmnopqrstuvwxyz"), 3)}
+	itr := NewBufferedStreamIter(rs, context.Background())
+
+	readValue := func(n int) []byte {
+		for i := 0; i < n; i++ {
+			itr.Next()
+		}
+
+		return itr.Value()
+	}
+
+	// values which span chunks are joined in a scratch buffer, and nothing is recycled until the iterator is released
+	values := [][]byte{readValue(2), readValue(3), readValue(8)}
+	require.Equal(t, []string{"ab", "cde", "fghijklm"}, []string{string(values[0]), string(values[1]), string(values[2])})
+	require.Empty(t, rs.recycled)
+
+	itr.Release()
+	require.Equal(t, []string{"abc", "def", "ghi", "jkl", "mno"}, func() []string {
+		var recycled []string
+		for _, chunk := range rs.recycled {
+			recycled = append(recycled, string(chunk))
+		}
+		return recycled
+	}())
+
+	// iteration continues from where it was after the release
+	require.Equal(t, "nopqrstu", string(readValue(8)))
+	require.Equal(t, "vwxyz", string(readValue(5)))
+	require.Equal(t, byte(0), itr.Next())
+}
+
+func TestBufferedByteStreamIterUnreleased(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	rs := &recyclingTestStream{TestByteStream: NewTestByteStream(data, 1)}
+	itr := NewBufferedStreamIter(rs, context.Background())
+
+	// an iterator which is never released holds on to a bounded number of chunks
+	var read []byte
+	for i := 0; i < len(data); i += 2 {
+		itr.Next()
+		itr.Next()
+		read = append(read, itr.Value()...)
+		require.LessOrEqual(t, len(itr.retiredChunks), maxRetired)
+		require.LessOrEqual(t, len(itr.retiredScratch), maxRetired)
+	}
+
+	require.Equal(t, data, read)
+	require.Empty(t, rs.recycled)
+}
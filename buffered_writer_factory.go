@@ -1,66 +1,144 @@
-package main
+package jsplit
 
 import (
 	"bufio"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
 // BufferedWriteCloser wraps an io.WriteCloser in a bufio.Writer object and provides an io.WriteCloser implementation
-// for the bufio.Writer object
+// for the bufio.Writer object.  Data may optionally be compressed before it is written to the io.WriteCloser.
 type BufferedWriteCloser struct {
-	name  string
-	start time.Time
-	wr    io.WriteCloser
-	bufWr *bufio.Writer
+	name    string
+	start   time.Time
+	wr      io.WriteCloser
+	enc     io.WriteCloser
+	counter *countingWriter
+	bufWr   *bufio.Writer
+	// logger records the file being closed. slog.Default() is used when it is nil
+	logger *slog.Logger
 }
 
 // NewBufferedWriteCloser returns a BufferedWriteCloser object which writes to the supplied io.WriteCloser
 func NewBufferedWriteCloser(name string, wr io.WriteCloser, bufferSize int) *BufferedWriteCloser {
-	bufWr := bufio.NewWriterSize(wr, bufferSize)
+	counter := &countingWriter{wr: wr}
+	bufWr := bufio.NewWriterSize(counter, bufferSize)
 	return &BufferedWriteCloser{
-		name:  name,
-		start: time.Now(),
-		wr:    wr,
-		bufWr: bufWr,
+		name:    name,
+		start:   time.Now(),
+		wr:      wr,
+		counter: counter,
+		bufWr:   bufWr,
 	}
 }
 
+// NewCompressingBufferedWriteCloser returns a BufferedWriteCloser object which compresses the data written to it using
+// the supplied compression format before writing it to the supplied io.WriteCloser
+func NewCompressingBufferedWriteCloser(name string, wr io.WriteCloser, bufferSize int, c Compression) (*BufferedWriteCloser, error) {
+	counter := &countingWriter{wr: wr}
+	enc, err := NewCompressingWriter(counter, c)
+	if err != nil {
+		return nil, err
+	}
+
+	bufWr := bufio.NewWriterSize(enc, bufferSize)
+	return &BufferedWriteCloser{
+		name:    name,
+		start:   time.Now(),
+		wr:      wr,
+		enc:     enc,
+		counter: counter,
+		bufWr:   bufWr,
+	}, nil
+}
+
 // Write calls write on the bufio.Writer object which wraps the io.WriterCloser
 func (bwc *BufferedWriteCloser) Write(p []byte) (n int, err error) {
 	return bwc.bufWr.Write(p)
 }
 
-// Close makes sure the bufio.Writer object flushes, and the supplied io.WriteCloser is closed
+// FileSize returns the number of bytes that have been written to the underlying io.WriteCloser.  For compressed
+// output this is the compressed size, and lags behind the data written as both the bufio.Writer and the encoder buffer
+// data before writing it.
+func (bwc *BufferedWriteCloser) FileSize() uint64 {
+	return bwc.counter.n
+}
+
+// Close makes sure the bufio.Writer object and encoder flush, and the supplied io.WriteCloser is closed. The
+// io.WriteCloser is closed even if flushing fails, and the first error encountered is returned
 func (bwc *BufferedWriteCloser) Close() error {
-	err := bwc.bufWr.Flush()
-	if err != nil {
-		return err
+	firstErr := bwc.bufWr.Flush()
+	if bwc.enc != nil {
+		err := bwc.enc.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	logger := bwc.logger
+	if logger == nil {
+		logger = slog.Default()
 	}
 
-	fmt.Printf("Closing %s after %f seconds\n", bwc.name, time.Since(bwc.start).Seconds())
+	logger.Info("Closing file", "file", bwc.name, "seconds", time.Since(bwc.start).Seconds())
+
+	err := bwc.wr.Close()
+	if err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	return firstErr
+}
 
-	return bwc.wr.Close()
+// countingWriter counts the bytes written to an io.Writer
+type countingWriter struct {
+	wr io.Writer
+	n  uint64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.wr.Write(p)
+	cw.n += uint64(n)
+	return n, err
 }
 
 // BufferedWriterFactory returns an object which can be used for creating jsonl files
 type BufferedWriterFactory struct {
-	format     string
-	index      int
-	bufferSize int
+	format      string
+	index       int
+	bufferSize  int
+	compression Compression
+	// progress records each file created when the progress of a split is reported
+	progress *progress
+	// logger logs each file created and is passed on to the files. Creating files is not logged when it is nil
+	logger *slog.Logger
 }
 
 // NewBufferedWriterFactory returns a *BufferedWriterFactory instance which creates files in the format [key]_%02d.jsonl
 // within the supplied directory.
 func NewBufferedWriterFactory(directory, key string, bufferSize int) *BufferedWriterFactory {
-	format := filepath.Join(directory, key+"_%02d.jsonl")
+	return NewBufferedWriterFactoryWithCompression(directory, key, bufferSize, CompressionNone)
+}
+
+// NewBufferedWriterFactoryWithCompression returns a *BufferedWriterFactory instance which creates files compressed
+// with the supplied compression format.  Files are named [key]_%02d.jsonl followed by the extension of the compression
+// format, for example [key]_%02d.jsonl.gz.  Path separators, control characters and % are percent encoded within the
+// key, so that keys read from untrusted documents always name a file within the directory.
+func NewBufferedWriterFactoryWithCompression(directory, key string, bufferSize int, c Compression) *BufferedWriterFactory {
+	// the separator is joined with the key so that an empty key still names a file within the directory, and any % in
+	// the path is escaped so that it is not interpreted as part of the format
+	prefix := strings.ReplaceAll(filepath.Join(directory, escapeFileName(key)+"_"), "%", "%%")
+	format := prefix + "%02d.jsonl" + c.Extension()
 	return &BufferedWriterFactory{
-		format:     format,
-		index:      0,
-		bufferSize: bufferSize,
+		format:      format,
+		index:       0,
+		bufferSize:  bufferSize,
+		compression: c,
 	}
 }
 
@@ -68,11 +146,44 @@ func NewBufferedWriterFactory(directory, key string, bufferSize int) *BufferedWr
 func (bwf *BufferedWriterFactory) CreateWriter() (io.WriteCloser, error) {
 	filename := fmt.Sprintf(bwf.format, bwf.index)
 	bwf.index++
+	bwf.progress.setCurrentFile(filename)
+	if bwf.logger != nil {
+		bwf.logger.Debug("Creating file", "file", filename)
+	}
 
 	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewBufferedWriteCloser(filename, f, bwf.bufferSize), nil
+	if bwf.compression == "" || bwf.compression == CompressionNone {
+		wr := NewBufferedWriteCloser(filename, f, bwf.bufferSize)
+		wr.logger = bwf.logger
+		return wr, nil
+	}
+
+	wr, err := NewCompressingBufferedWriteCloser(filename, f, bwf.bufferSize, bwf.compression)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	wr.logger = bwf.logger
+	return wr, nil
+}
+
+// escapeFileName percent encodes the bytes of name which could change the directory of a file, or which can't be used
+// in a file name.  % is also encoded so that distinct names are never escaped to the same file name.
+func escapeFileName(name string) string {
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		if ch == '/' || ch == '\\' || ch == '%' || ch < 0x20 || ch == 0x7f {
+			fmt.Fprintf(&sb, "%%%02X", ch)
+		} else {
+			sb.WriteByte(ch)
+		}
+	}
+
+	return sb.String()
 }
@@ -0,0 +1,42 @@
+package jsplit
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// failingWriteCloser fails every write, recording whether it has been closed
+type failingWriteCloser struct {
+	closed bool
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (fwc *failingWriteCloser) Write(p []byte) (int, error) {
+	return 0, errWriteFailed
+}
+
+func (fwc *failingWriteCloser) Close() error {
+	fwc.closed = true
+	return nil
+}
+
+func TestBufferedWriteCloserClosesAfterFailedFlush(t *testing.T) {
+	for _, c := range []Compression{CompressionNone, CompressionGzip} {
+		fwc := &failingWriteCloser{}
+		bwc, err := NewCompressingBufferedWriteCloser("test.jsonl", fwc, 1024, c)
+		require.NoError(t, err)
+		bwc.logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+		_, err = bwc.Write([]byte(`{"a":1}`))
+		require.NoError(t, err)
+
+		err = bwc.Close()
+		require.ErrorIs(t, err, errWriteFailed, "compression %s", c)
+		require.True(t, fwc.closed, "compression %s", c)
+	}
+}
@@ -0,0 +1,115 @@
+package jsplit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a number of bytes which can be parsed from, and formatted as, a human readable string such as 512MB or
+// 8MiB.  It implements flag.Value so it can be used directly as a command line flag.
+type ByteSize uint64
+
+var byteSizeUnits = map[string]uint64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"tib": 1 << 40,
+}
+
+var binaryUnits = []struct {
+	suffix string
+	size   uint64
+}{
+	{"TiB", 1 << 40},
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+}
+
+// ParseByteSize parses a size such as 4096, 512MB or 8MiB.  Units are case insensitive. KB, MB, GB and TB are powers
+// of 1000 and KiB, MiB, GiB and TiB are powers of 1024.  As with dd, the single letter units K, M, G and T are powers
+// of 1024.  Fractional values such as 1.5GiB are allowed as long as they resolve to a whole number of bytes.
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	numEnd := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+
+	if numEnd == -1 {
+		numEnd = len(s)
+	}
+
+	numStr, unitStr := s[:numEnd], strings.TrimSpace(s[numEnd:])
+	unit, ok := byteSizeUnits[strings.ToLower(unitStr)]
+	if !ok || len(numStr) == 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+
+	if n, err := strconv.ParseUint(numStr, 10, 64); err == nil {
+		if n > math.MaxUint64/unit {
+			return 0, fmt.Errorf("size '%s' is too large", s)
+		}
+
+		return ByteSize(n * unit), nil
+	}
+
+	f, err := strconv.ParseFloat(numStr, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+
+	size := f * float64(unit)
+	if size >= math.MaxUint64 {
+		return 0, fmt.Errorf("size '%s' is too large", s)
+	} else if size != math.Trunc(size) {
+		return 0, fmt.Errorf("size '%s' is not a whole number of bytes", s)
+	}
+
+	return ByteSize(size), nil
+}
+
+// String formats the size using the largest binary unit which represents it exactly
+func (bs ByteSize) String() string {
+	for _, u := range binaryUnits {
+		if bs != 0 && uint64(bs)%u.size == 0 {
+			return strconv.FormatUint(uint64(bs)/u.size, 10) + u.suffix
+		}
+	}
+
+	return strconv.FormatUint(uint64(bs), 10) + "B"
+}
+
+// approxString formats the size to one decimal place using the largest binary unit which is no larger than it, such as
+// 1.5GiB
+func (bs ByteSize) approxString() string {
+	for _, u := range binaryUnits {
+		if uint64(bs) >= u.size {
+			return strconv.FormatFloat(float64(bs)/float64(u.size), 'f', 1, 64) + u.suffix
+		}
+	}
+
+	return strconv.FormatUint(uint64(bs), 10) + "B"
+}
+
+// Set parses the supplied string and sets the value.  Implements flag.Value
+func (bs *ByteSize) Set(s string) error {
+	size, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+
+	*bs = size
+	return nil
+}
@@ -0,0 +1,55 @@
+package jsplit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		str      string
+		expected ByteSize
+	}{
+		{"0", 0},
+		{"4096", 4096},
+		{"100B", 100},
+		{"512MB", 512 * 1000 * 1000},
+		{"8MiB", 8 * 1024 * 1024},
+		{"8mib", 8 * 1024 * 1024},
+		{"256K", 256 * 1024},
+		{"256 KiB", 256 * 1024},
+		{"4GB", 4 * 1000 * 1000 * 1000},
+		{"4G", 4 * 1024 * 1024 * 1024},
+		{"1.5GiB", 3 * 512 * 1024 * 1024},
+		{"2TiB", 2 * 1024 * 1024 * 1024 * 1024},
+	}
+
+	for _, test := range tests {
+		t.Run(test.str, func(t *testing.T) {
+			size, err := ParseByteSize(test.str)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, size)
+		})
+	}
+
+	for _, invalid := range []string{"", "MB", "12XB", "-1", "1.5", "1.2.3MB", "99999999999TiB"} {
+		t.Run("invalid "+invalid, func(t *testing.T) {
+			_, err := ParseByteSize(invalid)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	require.Equal(t, "0B", ByteSize(0).String())
+	require.Equal(t, "1000B", ByteSize(1000).String())
+	require.Equal(t, "256KiB", ByteSize(256*1024).String())
+	require.Equal(t, "1MiB", ByteSize(1024*1024).String())
+	require.Equal(t, "4GiB", ByteSize(DefaultSplitSize).String())
+
+	var bs ByteSize
+	require.NoError(t, bs.Set("8MiB"))
+	require.Equal(t, ByteSize(8*1024*1024), bs)
+	require.Error(t, bs.Set("eight"))
+}
@@ -1,6 +1,6 @@
-package main
+package jsplit
 
-// ByteStack is a simple stack of bytes
+// ByteStack is a simple stack of bytes. The zero value is an empty stack ready to use
 type ByteStack struct {
 	chars []byte
 }
@@ -15,6 +15,11 @@ func (bs *ByteStack) Push(b byte) {
 	bs.chars = append(bs.chars, b)
 }
 
+// Reset empties the stack keeping its storage for reuse
+func (bs *ByteStack) Reset() {
+	bs.chars = bs.chars[:0]
+}
+
 // Pop takes the top value of the top of the stack and returns it
 func (bs *ByteStack) Pop() byte {
 	l := len(bs.chars)
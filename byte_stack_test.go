@@ -1,4 +1,4 @@
-package main
+package jsplit
 
 import (
 	"github.com/stretchr/testify/require"
@@ -24,4 +24,13 @@ func TestByteStack(t *testing.T) {
 
 	require.Equal(t, byte(0), bs.Peek())
 	require.Equal(t, byte(0), bs.Pop())
+
+	bs.Push(byte('3'))
+	bs.Push(byte('4'))
+	bs.Reset()
+	require.Equal(t, byte(0), bs.Peek())
+
+	var zero ByteStack
+	zero.Push(byte('5'))
+	require.Equal(t, byte('5'), zero.Pop())
 }
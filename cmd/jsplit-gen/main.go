@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dolthub/jsplit"
+	"github.com/dolthub/jsplit/internal/docgen"
+)
+
+func errExit(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
+	}
+}
+
+// defaultSize is the default size of the generated document
+const defaultSize = 64 << 20
+
+func main() {
+	var outputPath string
+	var shapeName string
+	var seed int64
+	var indent bool
+	var compressionName string
+	size := jsplit.ByteSize(defaultSize)
+
+	shapeNames := make([]string, len(docgen.Shapes))
+	for i, shape := range docgen.Shapes {
+		shapeNames[i] = string(shape)
+	}
+
+	flag.StringVar(&outputPath, "output", "", "File the generated document is written to. Use - or omit to write to stdout")
+	flag.StringVar(&shapeName, "shape", string(docgen.ShapeTiny), "Shape of the document: "+strings.Join(shapeNames, ", "))
+	flag.Var(&size, "size", "Approximate size of the uncompressed document, e.g. 1GiB")
+	flag.Int64Var(&seed, "seed", 1, "Seed of the random values in the document. The same seed always generates the same document")
+	flag.BoolVar(&indent, "indent", false, "Write each list item on its own indented line")
+	flag.StringVar(&compressionName, "compression", "none", "Compression of the document: none, gzip or zstd")
+	flag.Parse()
+
+	shape, err := docgen.ParseShape(shapeName)
+	errExit(err)
+
+	compression, err := jsplit.ParseCompression(compressionName)
+	errExit(err)
+	errExit(jsplit.ValidateOutputCompression(compression))
+
+	var wr io.WriteCloser = os.Stdout
+	if len(outputPath) != 0 && outputPath != "-" {
+		wr, err = os.Create(outputPath)
+		errExit(err)
+	}
+
+	cw, err := jsplit.NewCompressingWriter(wr, compression)
+	errExit(err)
+
+	errExit(docgen.Generate(cw, shape, int64(size), seed, indent))
+	errExit(cw.Close())
+	errExit(wr.Close())
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dolthub/jsplit"
+)
+
+// logger writes the messages logged while splitting to stderr. It is nil until the flags have been parsed
+var logger *slog.Logger
+
+func errExit(err error) {
+	if err != nil {
+		if logger != nil {
+			logger.Error(strings.TrimPrefix(err.Error(), "error: "))
+		} else {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+
+		os.Exit(1)
+	}
+}
+
+// newLogger creates the logger writing to stderr in the requested format. Messages below level are discarded
+func newLogger(format string, level slog.Level) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+
+	return nil, fmt.Errorf("error: unknown log-format '%s'", format)
+}
+
+// progressFunc returns the function logging each progress snapshot. The json format logs the values of the snapshot as
+// a group. The text handler would log each value of the group as a separate progress.* attribute, so the text format
+// logs the line returned by String as the message instead.
+func progressFunc(logger *slog.Logger, format string) func(jsplit.ProgressSnapshot) {
+	if strings.EqualFold(format, "json") {
+		return func(ps jsplit.ProgressSnapshot) {
+			logger.Info("Progress", "progress", ps)
+		}
+	}
+
+	return func(ps jsplit.ProgressSnapshot) {
+		logger.Info(ps.String())
+	}
+}
+
+// stringsFlag is a flag.Value which collects the values of a flag that may be given multiple times
+type stringsFlag []string
+
+func (sf *stringsFlag) String() string {
+	return strings.Join(*sf, ",")
+}
+
+func (sf *stringsFlag) Set(s string) error {
+	*sf = append(*sf, s)
+	return nil
+}
+
+// defaultWriters is the default number of goroutines writing the jsonl files
+const defaultWriters = 4
+
+func validateBufferSize(name string, size jsplit.ByteSize) error {
+	if size == 0 || uint64(size) > math.MaxInt32 {
+		return fmt.Errorf("error: %s must be between 1B and 2GiB", name)
+	}
+
+	return nil
+}
+
+func main() {
+	var filename string
+	var outputPath string
+	var compressionName string
+	var encodingName string
+	var outputCompressionName string
+	var splitCompressed bool
+	var splitSize jsplit.ByteSize
+	var splitItems int
+	var paths stringsFlag
+	var rootListName string
+	var strict bool
+	var invalidUTF8Name string
+	var controlCharsName string
+	var writers int
+	var writerQueue int
+	var parallelism int
+	var progressInterval time.Duration
+	var quiet bool
+	var verbose bool
+	var logFormat string
+	parallelChunkSize := jsplit.ByteSize(jsplit.DefaultParallelChunkSize)
+	readBufferSize := jsplit.ByteSize(jsplit.DefaultReadBufferSize)
+	writeBufferSize := jsplit.ByteSize(jsplit.DefaultWriteBufferSize)
+
+	flag.StringVar(&filename, "file", "", "Source JSON file. Use - or omit to read from stdin")
+	flag.StringVar(&outputPath, "output", "", "Output path for parsed JSON files (optional when reading a file)")
+	flag.StringVar(&compressionName, "compression", "", "Compression of the input: auto, none, gzip, zstd, bzip2, xz or zip (optional, detected from the input if omitted)")
+	flag.StringVar(&encodingName, "encoding", "auto", "Character encoding of the input: auto, utf-8, utf-16le, utf-16be, utf-32le or utf-32be")
+	flag.StringVar(&outputCompressionName, "output-compression", "none", "Compression of the jsonl files: none, gzip or zstd")
+	flag.Var(&splitSize, "split-size", "Size of the data written to a jsonl file before a new file is started, e.g. 512MB or 1GiB (default 4GiB unless -split-items is set)")
+	flag.IntVar(&splitItems, "split-items", 0, "Maximum number of items written to a jsonl file before a new file is started (optional)")
+	flag.Var(&paths, "path", "Path of a list to extract such as /data/records or response.items. May be given multiple times (default every list in the root of the document)")
+	flag.StringVar(&rootListName, "root-list-name", jsplit.DefaultRootListName, "Name of the jsonl files written when the root of the document is a list")
+	flag.BoolVar(&strict, "strict", false, "Fully validate the json while splitting, failing on the first violation of RFC 8259")
+	flag.StringVar(&invalidUTF8Name, "invalid-utf8", "ignore", "Handling of list items which are not valid UTF-8: ignore, fail, replace or reject")
+	flag.StringVar(&controlCharsName, "control-chars", "escape", "Handling of raw control characters such as line breaks inside strings: escape, reject or preserve")
+	flag.Var(&readBufferSize, "read-buffer", "Size of the chunks read from the input, e.g. 8MiB")
+	flag.Var(&writeBufferSize, "write-buffer", "Size of the buffer used when writing each jsonl file, e.g. 1MiB")
+	flag.IntVar(&writers, "writers", defaultWriters, "Number of goroutines writing and compressing the jsonl files while the input is parsed. 0 writes them on the parsing goroutine")
+	flag.IntVar(&writerQueue, "writer-queue", jsplit.DefaultWriterQueueSize, "Number of 64KiB batches of items queued for each list before parsing waits for them to be written")
+	flag.IntVar(&parallelism, "parallel", 1, "Number of goroutines parsing the lists of an uncompressed UTF-8 input file in parallel. Compressed inputs, stdin pipes, -strict and -path are split sequentially")
+	flag.Var(&parallelChunkSize, "parallel-chunk", "Size of the chunks of list items parsed by each goroutine when splitting in parallel, e.g. 16MiB")
+	flag.DurationVar(&progressInterval, "progress", jsplit.DefaultProgressInterval, "Interval between progress lines showing the percentage of the input read, MB/s, ETA and items written, e.g. 30s. 0 disables them")
+	flag.BoolVar(&quiet, "quiet", false, "Only log warnings and errors. Progress is not reported")
+	flag.BoolVar(&verbose, "v", false, "Log debug detail such as each jsonl file being created")
+	flag.StringVar(&logFormat, "log-format", "text", "Format of the messages logged to stderr: text or json")
+	flag.BoolVar(&splitCompressed, "split-compressed", false, "Apply the split size to the compressed size of the jsonl files rather than the uncompressed size")
+	flag.Parse()
+
+	if quiet && verbose {
+		errExit(fmt.Errorf("error: quiet and v can't be used together"))
+	}
+
+	level := slog.LevelInfo
+	if quiet {
+		level = slog.LevelWarn
+	} else if verbose {
+		level = slog.LevelDebug
+	}
+
+	var err error
+	logger, err = newLogger(logFormat, level)
+	errExit(err)
+
+	readStdin := len(filename) == 0 || filename == "-"
+	if len(outputPath) == 0 {
+		if readStdin {
+			fmt.Fprintln(os.Stderr, "Usage: jsplit -file <json_file> -output <output_path>")
+			fmt.Fprintln(os.Stderr, "       <command> | jsplit -output <output_path>")
+			flag.PrintDefaults()
+			os.Exit(1)
+		}
+
+		outputPath = strings.Replace(filename, ".", "_", -1)
+	}
+
+	if _, err := os.Stat(outputPath); err == nil {
+		errExit(fmt.Errorf("error: %s already exists", outputPath))
+	} else if !os.IsNotExist(err) {
+		errExit(err)
+	}
+
+	errExit(validateBufferSize("read-buffer", readBufferSize))
+	errExit(validateBufferSize("write-buffer", writeBufferSize))
+	errExit(validateBufferSize("parallel-chunk", parallelChunkSize))
+
+	if writers < 0 || writerQueue < 1 {
+		errExit(fmt.Errorf("error: writers must be 0 or more and writer-queue must be at least 1"))
+	}
+
+	if parallelism < 1 {
+		errExit(fmt.Errorf("error: parallel must be at least 1"))
+	}
+
+	if progressInterval < 0 {
+		errExit(fmt.Errorf("error: progress must not be negative"))
+	}
+
+	compression, err := jsplit.ParseCompression(compressionName)
+	errExit(err)
+
+	encoding, err := jsplit.ParseEncoding(encodingName)
+	errExit(err)
+
+	outputCompression, err := jsplit.ParseCompression(outputCompressionName)
+	errExit(err)
+	errExit(jsplit.ValidateOutputCompression(outputCompression))
+
+	invalidUTF8, err := jsplit.ParseInvalidUTF8Mode(invalidUTF8Name)
+	errExit(err)
+
+	controlChars, err := jsplit.ParseControlCharMode(controlCharsName)
+	errExit(err)
+
+	var rd io.ReadCloser
+	if readStdin {
+		filename = "stdin"
+		rd = os.Stdin
+	} else {
+		rd, err = os.Open(filename)
+		errExit(err)
+	}
+	defer rd.Close()
+
+	err = os.Mkdir(outputPath, os.ModePerm)
+	errExit(err)
+
+	var onProgress func(jsplit.ProgressSnapshot)
+	if progressInterval > 0 && !quiet {
+		onProgress = progressFunc(logger, logFormat)
+	}
+
+	splitter, err := jsplit.NewSplitter(jsplit.SplitterOptions{
+		Reader:                rd,
+		Compression:           compression,
+		Encoding:              encoding,
+		OutputDir:             outputPath,
+		SplitSize:             uint64(splitSize),
+		MaxItemsPerFile:       splitItems,
+		Paths:                 paths,
+		RootListName:          rootListName,
+		Strict:                strict,
+		InvalidUTF8:           invalidUTF8,
+		ControlChars:          controlChars,
+		ReadBufferSize:        int(readBufferSize),
+		WriteBufferSize:       int(writeBufferSize),
+		WriterGoroutines:      writers,
+		WriterQueueSize:       writerQueue,
+		Parallelism:           parallelism,
+		ParallelChunkSize:     int(parallelChunkSize),
+		OutputCompression:     outputCompression,
+		SplitOnCompressedSize: splitCompressed,
+		OnProgress:            onProgress,
+		ProgressInterval:      progressInterval,
+		Logger:                logger,
+	})
+	errExit(err)
+
+	logger.Info("Reading", "file", filename)
+	err = splitter.Split(context.Background())
+	errExit(err)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/dolthub/jsplit"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressFunc(t *testing.T) {
+	ps := jsplit.ProgressSnapshot{
+		Elapsed:      10 * time.Second,
+		InputSize:    4000,
+		InputBytes:   1000,
+		DecodedBytes: 1000,
+		Items:        map[string]int64{"a": 40},
+		CurrentFile:  "out/a_03.jsonl",
+	}
+
+	var buf bytes.Buffer
+	progressFunc(slog.New(slog.NewTextHandler(&buf, nil)), "text")(ps)
+	require.Contains(t, buf.String(), `msg="Progress: 25.0% of 3.9KiB read at 0.0 MB/s, ETA 30s, 40 items (a: 40), writing out/a_03.jsonl"`)
+	require.NotContains(t, buf.String(), "progress.")
+
+	buf.Reset()
+	progressFunc(slog.New(slog.NewJSONHandler(&buf, nil)), "json")(ps)
+
+	var logged struct {
+		Msg      string         `json:"msg"`
+		Progress map[string]any `json:"progress"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+	require.Equal(t, "Progress", logged.Msg)
+	require.Equal(t, 25.0, logged.Progress["percent"])
+}
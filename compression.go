@@ -0,0 +1,173 @@
+package jsplit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Compression identifies the compression format of a stream
+type Compression string
+
+const (
+	// CompressionAuto detects the compression format from the magic number at the start of the stream
+	CompressionAuto  Compression = "auto"
+	CompressionNone  Compression = "none"
+	CompressionGzip  Compression = "gzip"
+	CompressionZstd  Compression = "zstd"
+	CompressionBzip2 Compression = "bzip2"
+	CompressionXz    Compression = "xz"
+	// CompressionZip reads the first entry of a zip archive
+	CompressionZip Compression = "zip"
+)
+
+var magicNumbers = []struct {
+	magic       []byte
+	compression Compression
+}{
+	{[]byte{0x1f, 0x8b, 0x08}, CompressionGzip},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, CompressionZstd},
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, CompressionXz},
+	{[]byte{'P', 'K', 0x03, 0x04}, CompressionZip},
+}
+
+// maxMagicLen is the number of bytes that need to be inspected to identify any of the supported formats
+const maxMagicLen = 6
+
+// ParseCompression converts the name of a compression format to a Compression.  An empty string is treated as
+// CompressionAuto.
+func ParseCompression(name string) (Compression, error) {
+	switch c := Compression(strings.ToLower(name)); c {
+	case "":
+		return CompressionAuto, nil
+	case CompressionAuto, CompressionNone, CompressionGzip, CompressionZstd, CompressionBzip2, CompressionXz, CompressionZip:
+		return c, nil
+	}
+
+	return "", fmt.Errorf("unknown compression '%s'", name)
+}
+
+// DetectCompression identifies the compression format of a stream by peeking at its magic number.  No data is consumed
+// from br.  Streams which do not start with a known magic number are reported as CompressionNone.
+func DetectCompression(br *bufio.Reader) (Compression, error) {
+	start, err := br.Peek(maxMagicLen)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", err
+	}
+
+	for _, mn := range magicNumbers {
+		if bytes.HasPrefix(start, mn.magic) {
+			return mn.compression, nil
+		}
+	}
+
+	// bzip2 streams start with "BZh" followed by the block size which is a digit from 1-9
+	if len(start) >= 4 && bytes.HasPrefix(start, []byte("BZh")) && start[3] >= '1' && start[3] <= '9' {
+		return CompressionBzip2, nil
+	}
+
+	return CompressionNone, nil
+}
+
+// NewDecompressingReader wraps rd in a decoder for the specified compression format.  CompressionAuto detects the
+// format using DetectCompression. Closing the returned io.ReadCloser releases the decoder but does not close rd.
+func NewDecompressingReader(rd io.Reader, c Compression) (io.ReadCloser, error) {
+	if c == "" || c == CompressionAuto {
+		br := bufio.NewReader(rd)
+
+		var err error
+		c, err = DetectCompression(br)
+		if err != nil {
+			return nil, err
+		}
+
+		rd = br
+	}
+
+	switch c {
+	case CompressionNone:
+		return io.NopCloser(rd), nil
+
+	case CompressionGzip:
+		return NewParallelGzipReader(rd, runtime.GOMAXPROCS(0)), nil
+
+	case CompressionZstd:
+		dec, err := zstd.NewReader(rd)
+		if err != nil {
+			return nil, err
+		}
+
+		return dec.IOReadCloser(), nil
+
+	case CompressionBzip2:
+		return io.NopCloser(bzip2.NewReader(rd)), nil
+
+	case CompressionXz:
+		xr, err := xz.NewReader(rd)
+		if err != nil {
+			return nil, err
+		}
+
+		return io.NopCloser(xr), nil
+
+	case CompressionZip:
+		return newZipEntryReader(rd)
+	}
+
+	return nil, fmt.Errorf("unknown compression '%s'", c)
+}
+
+// Extension returns the file extension used for files written with the compression format
+func (c Compression) Extension() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+
+	return ""
+}
+
+// ValidateOutputCompression returns an error if the compression format cannot be used for writing output files
+func ValidateOutputCompression(c Compression) error {
+	switch c {
+	case "", CompressionNone, CompressionGzip, CompressionZstd:
+		return nil
+	}
+
+	return fmt.Errorf("'%s' is not supported for output, use none, gzip or zstd", c)
+}
+
+// NewCompressingWriter wraps wr in an encoder for the specified compression format. Closing the returned
+// io.WriteCloser flushes the encoder but does not close wr.
+func NewCompressingWriter(wr io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case "", CompressionNone:
+		return nopWriteCloser{wr}, nil
+
+	case CompressionGzip:
+		return gzip.NewWriter(wr), nil
+
+	case CompressionZstd:
+		return zstd.NewWriter(wr)
+	}
+
+	return nil, ValidateOutputCompression(c)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,184 @@
+package jsplit
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+)
+
+const compressionTestDoc = `{"list":[1,2,3]}`
+
+// bzip2Doc is compressionTestDoc compressed with the bzip2 command line tool as the standard library has no encoder
+var bzip2Doc = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xf3, 0xb5,
+	0x42, 0x79, 0x00, 0x00, 0x07, 0x1b, 0x80, 0x10, 0x04, 0x38, 0x10, 0x00,
+	0x0a, 0x00, 0x24, 0x0c, 0x0a, 0x20, 0x00, 0x31, 0x00, 0x00, 0x0a, 0x62,
+	0x63, 0x49, 0xe8, 0x1b, 0xf3, 0x88, 0xe4, 0x00, 0x58, 0xde, 0x66, 0x8b,
+	0xb9, 0x22, 0x9c, 0x28, 0x48, 0x79, 0xda, 0xa1, 0x3c, 0x80,
+}
+
+func compressTestDoc(t *testing.T, c Compression) []byte {
+	buf := bytes.NewBuffer(nil)
+
+	var wr io.WriteCloser
+	var err error
+	switch c {
+	case CompressionNone:
+		return []byte(compressionTestDoc)
+	case CompressionBzip2:
+		return bzip2Doc
+	case CompressionGzip:
+		wr = gzip.NewWriter(buf)
+	case CompressionZstd:
+		wr, err = zstd.NewWriter(buf)
+	case CompressionXz:
+		wr, err = xz.NewWriter(buf)
+	}
+	require.NoError(t, err)
+
+	_, err = wr.Write([]byte(compressionTestDoc))
+	require.NoError(t, err)
+	require.NoError(t, wr.Close())
+
+	return buf.Bytes()
+}
+
+func TestNewDecompressingReader(t *testing.T) {
+	for _, c := range []Compression{CompressionNone, CompressionGzip, CompressionZstd, CompressionBzip2, CompressionXz} {
+		t.Run(string(c), func(t *testing.T) {
+			rd, err := NewDecompressingReader(bytes.NewReader(compressTestDoc(t, c)), c)
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(rd)
+			require.NoError(t, err)
+			require.NoError(t, rd.Close())
+			require.Equal(t, compressionTestDoc, string(data))
+		})
+	}
+}
+
+func TestOpenFile(t *testing.T) {
+	for _, c := range []Compression{CompressionNone, CompressionGzip, CompressionZstd, CompressionBzip2, CompressionXz} {
+		t.Run(string(c), func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "doc.json"+c.Extension())
+			require.NoError(t, os.WriteFile(filename, compressTestDoc(t, c), os.ModePerm))
+
+			rd, err := OpenFile(filename)
+			require.NoError(t, err)
+			defer rd.Close()
+
+			// uncompressed files are returned as the *os.File so they can be split in parallel
+			_, isFile := rd.(*os.File)
+			require.Equal(t, c == CompressionNone, isFile)
+
+			data, err := io.ReadAll(rd)
+			require.NoError(t, err)
+			require.Equal(t, compressionTestDoc, string(data))
+		})
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected Compression
+	}{
+		{"json", []byte(compressionTestDoc), CompressionNone},
+		{"empty", []byte{}, CompressionNone},
+		{"short", []byte{0x1f}, CompressionNone},
+		{"gzip", compressTestDoc(t, CompressionGzip), CompressionGzip},
+		{"zstd", compressTestDoc(t, CompressionZstd), CompressionZstd},
+		{"bzip2", compressTestDoc(t, CompressionBzip2), CompressionBzip2},
+		{"xz", compressTestDoc(t, CompressionXz), CompressionXz},
+		{"zip", zipTestDoc(t, zip.Deflate), CompressionZip},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			br := bufio.NewReader(bytes.NewReader(test.data))
+			c, err := DetectCompression(br)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, c)
+
+			// detection must not consume any data
+			data, err := io.ReadAll(br)
+			require.NoError(t, err)
+			require.Equal(t, test.data, data)
+		})
+	}
+}
+
+func zipTestDoc(t *testing.T, method uint16) []byte {
+	buf := bytes.NewBuffer(nil)
+	zw := zip.NewWriter(buf)
+
+	var wr io.Writer
+	var err error
+	if method == zip.Store {
+		// CreateRaw writes the sizes to the local file header rather than using a data descriptor
+		wr, err = zw.CreateRaw(&zip.FileHeader{
+			Name:               "doc.json",
+			Method:             zip.Store,
+			CRC32:              crc32.ChecksumIEEE([]byte(compressionTestDoc)),
+			CompressedSize64:   uint64(len(compressionTestDoc)),
+			UncompressedSize64: uint64(len(compressionTestDoc)),
+		})
+	} else {
+		wr, err = zw.Create("doc.json")
+	}
+	require.NoError(t, err)
+
+	_, err = wr.Write([]byte(compressionTestDoc))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	return buf.Bytes()
+}
+
+func TestAutoDecompression(t *testing.T) {
+	tests := map[string][]byte{
+		"none":        []byte(compressionTestDoc),
+		"gzip":        compressTestDoc(t, CompressionGzip),
+		"zstd":        compressTestDoc(t, CompressionZstd),
+		"bzip2":       compressTestDoc(t, CompressionBzip2),
+		"xz":          compressTestDoc(t, CompressionXz),
+		"zip deflate": zipTestDoc(t, zip.Deflate),
+		"zip store":   zipTestDoc(t, zip.Store),
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			rd, err := NewDecompressingReader(bytes.NewReader(data), CompressionAuto)
+			require.NoError(t, err)
+
+			decompressed, err := io.ReadAll(rd)
+			require.NoError(t, err)
+			require.NoError(t, rd.Close())
+			require.Equal(t, compressionTestDoc, string(decompressed))
+		})
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	c, err := ParseCompression("")
+	require.NoError(t, err)
+	require.Equal(t, CompressionAuto, c)
+
+	c, err = ParseCompression("ZSTD")
+	require.NoError(t, err)
+	require.Equal(t, CompressionZstd, c)
+
+	_, err = ParseCompression("lz4")
+	require.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package jsplit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ControlCharMode controls how raw control characters (bytes below 0x20) found inside strings are handled.  RFC 8259
+// requires these characters to be escaped, but many producers write tabs and line breaks without escaping them.
+type ControlCharMode string
+
+const (
+	// ControlCharEscape writes control characters as the equivalent escape sequence, such as \n or \u0001, so the
+	// value of the string is unchanged and every item is written on a single line
+	ControlCharEscape ControlCharMode = "escape"
+	// ControlCharReject fails with a *SyntaxError at the first control character
+	ControlCharReject ControlCharMode = "reject"
+	// ControlCharPreserve writes objects and lists exactly as they were read, including the whitespace between their
+	// values, which is otherwise removed. Items containing raw line breaks, whether inside strings or between values,
+	// will span more than one line of their jsonl file
+	ControlCharPreserve ControlCharMode = "preserve"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// ParseControlCharMode returns the ControlCharMode with the supplied name. An empty name returns ControlCharEscape
+func ParseControlCharMode(name string) (ControlCharMode, error) {
+	switch m := ControlCharMode(strings.ToLower(name)); m {
+	case "":
+		return ControlCharEscape, nil
+	case ControlCharEscape, ControlCharReject, ControlCharPreserve:
+		return m, nil
+	}
+
+	return "", fmt.Errorf("unknown control character mode '%s'", name)
+}
+
+// appendEscapedControlChar appends the json escape sequence for the control character ch to dst
+func appendEscapedControlChar(dst []byte, ch byte) []byte {
+	switch ch {
+	case '\b':
+		return append(dst, Escape, 'b')
+	case '\f':
+		return append(dst, Escape, 'f')
+	case LF:
+		return append(dst, Escape, 'n')
+	case CR:
+		return append(dst, Escape, 'r')
+	case TAB:
+		return append(dst, Escape, 't')
+	}
+
+	return append(dst, Escape, 'u', '0', '0', hexDigits[ch>>4], hexDigits[ch&0xf])
+}
+
+// escapeControlChars returns a copy of the string str with each control character replaced by its escape sequence
+func escapeControlChars(str []byte) []byte {
+	escaped := make([]byte, 0, len(str)+16)
+	for _, ch := range str {
+		if ch < 0x20 {
+			escaped = appendEscapedControlChar(escaped, ch)
+		} else {
+			escaped = append(escaped, ch)
+		}
+	}
+
+	return escaped
+}
@@ -0,0 +1,135 @@
+package jsplit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseControlCharMode(t *testing.T) {
+	mode, err := ParseControlCharMode("")
+	require.NoError(t, err)
+	require.Equal(t, ControlCharEscape, mode)
+
+	mode, err = ParseControlCharMode("Preserve")
+	require.NoError(t, err)
+	require.Equal(t, ControlCharPreserve, mode)
+
+	_, err = ParseControlCharMode("strip")
+	require.Error(t, err)
+}
+
+func TestEscapeControlChars(t *testing.T) {
+	require.Equal(t, `a\r\nb\tc\b\f\u0001\u001f`, string(escapeControlChars([]byte("a\r\nb\tc\b\f\x01\x1f"))))
+	require.Equal(t, `no control chars \"`, string(escapeControlChars([]byte(`no control chars \"`))))
+}
+
+func TestParseControlChars(t *testing.T) {
+	const obj = "{\"text\": \"line one\r\nline two\ttabbed\", \"list\": [\"a\nb\"],\n\t\"n\": 1}"
+
+	tests := []struct {
+		mode     ControlCharMode
+		expected string
+	}{
+		{"", `{"text":"line one\r\nline two\ttabbed","list":["a\nb"],"n":1}`},
+		{ControlCharEscape, `{"text":"line one\r\nline two\ttabbed","list":["a\nb"],"n":1}`},
+		// preserve copies the object verbatim, including the whitespace between its values
+		{ControlCharPreserve, obj},
+	}
+
+	for _, test := range tests {
+		t.Run("object "+string(test.mode), func(t *testing.T) {
+			p := &Parser{ControlChars: test.mode}
+			res, err := p.ParseObject(NewTestItr(obj))
+			require.NoError(t, err)
+			require.Equal(t, test.expected, string(res))
+		})
+
+		t.Run("string "+string(test.mode), func(t *testing.T) {
+			p := &Parser{ControlChars: test.mode}
+			_, res, err := p.ParseVal(NewTestItr("\"a\r\nb\\\\\",\n"), nil, List)
+			require.NoError(t, err)
+
+			if test.mode == ControlCharPreserve {
+				require.Equal(t, "\"a\r\nb\\\\\"", string(res))
+			} else {
+				require.Equal(t, `"a\r\nb\\"`, string(res))
+			}
+		})
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		p := &Parser{ControlChars: ControlCharReject}
+		_, err := p.ParseObject(NewTestItr(obj))
+		require.Error(t, err)
+
+		var se *SyntaxError
+		require.True(t, errors.As(err, &se))
+		require.Equal(t, `invalid control character '\r' in string`, se.Msg)
+		require.Equal(t, Position{Offset: 18, Line: 1, Column: 19}, se.Position)
+
+		_, _, err = p.ParseVal(NewTestItr("\"a\tb\""), nil, List)
+		require.Error(t, err)
+	})
+}
+
+func TestSplitStreamControlChars(t *testing.T) {
+	const doc = "{\"name\": \"two\nlines\", \"items\": [\"CR\rLF\n\", {\"tab\": \"a\tb\"}, [\"\x01\"]]}"
+
+	tempDir := t.TempDir()
+	err := SplitStream(context.Background(), NewTestByteStream([]byte(doc), 5), tempDir)
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(tempDir, "root.json"), "{\n\t\"name\":\"two\\nlines\"\n}")
+	requireContents(t, filepath.Join(tempDir, "items_00.jsonl"), `"CR\rLF\n"`+"\n"+`{"tab":"a\tb"}`+"\n"+`["\u0001"]`)
+
+	// each line decodes to the same value as the original item
+	data, err := os.ReadFile(filepath.Join(tempDir, "items_00.jsonl"))
+	require.NoError(t, err)
+
+	expected := []interface{}{"CR\rLF\n", map[string]interface{}{"tab": "a\tb"}, []interface{}{"\x01"}}
+	for i, line := range strings.Split(string(data), "\n") {
+		var item interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &item))
+		require.Equal(t, expected[i], item)
+	}
+}
+
+func TestSplitterPreservesItems(t *testing.T) {
+	// the items are long enough for the structural index to be used when copying them
+	items := []string{
+		"{\n  \"text\": \"two\nlines\",\n  \"padding\": \"" + strings.Repeat("x", 100) + "\"\n}",
+		"[ 1,\t2 ,\r\n3 ]",
+		"{\"compact\":true}",
+	}
+	doc := "{\"items\": [\n" + strings.Join(items, ",\n") + "\n]}"
+
+	filename := filepath.Join(t.TempDir(), "doc.json")
+	require.NoError(t, os.WriteFile(filename, []byte(doc), os.ModePerm))
+
+	for _, parallelism := range []int{1, 2} {
+		f, err := os.Open(filename)
+		require.NoError(t, err)
+		defer f.Close()
+
+		tempDir := t.TempDir()
+		s, err := NewSplitter(SplitterOptions{
+			Reader:            f,
+			OutputDir:         tempDir,
+			ControlChars:      ControlCharPreserve,
+			ReadBufferSize:    64,
+			Parallelism:       parallelism,
+			ParallelChunkSize: 64,
+		})
+		require.NoError(t, err)
+		require.NoError(t, s.Split(context.Background()))
+
+		requireContents(t, filepath.Join(tempDir, "items_00.jsonl"), strings.Join(items, "\n"))
+	}
+}
@@ -0,0 +1,244 @@
+package jsplit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding identifies the character encoding of a stream
+type Encoding string
+
+const (
+	// EncodingAuto detects the encoding from the byte order mark at the start of the stream, or from the pattern of
+	// zero bytes in the first characters of the document if there is no byte order mark
+	EncodingAuto    Encoding = "auto"
+	EncodingUTF8    Encoding = "utf-8"
+	EncodingUTF16LE Encoding = "utf-16le"
+	EncodingUTF16BE Encoding = "utf-16be"
+	EncodingUTF32LE Encoding = "utf-32le"
+	EncodingUTF32BE Encoding = "utf-32be"
+)
+
+// transcodeBufferSize is the size of the buffer used to read data which is being transcoded to UTF-8
+const transcodeBufferSize = 32 * 1024
+
+// byteOrderMarks lists the byte order marks of each encoding.  UTF-32LE must be checked before UTF-16LE as its byte
+// order mark starts with the UTF-16LE byte order mark
+var byteOrderMarks = []struct {
+	bom      []byte
+	encoding Encoding
+}{
+	{[]byte{0xef, 0xbb, 0xbf}, EncodingUTF8},
+	{[]byte{0xff, 0xfe, 0x00, 0x00}, EncodingUTF32LE},
+	{[]byte{0x00, 0x00, 0xfe, 0xff}, EncodingUTF32BE},
+	{[]byte{0xff, 0xfe}, EncodingUTF16LE},
+	{[]byte{0xfe, 0xff}, EncodingUTF16BE},
+}
+
+// ParseEncoding returns the Encoding with the supplied name. An empty name returns EncodingAuto
+func ParseEncoding(name string) (Encoding, error) {
+	switch e := Encoding(strings.ToLower(name)); e {
+	case "":
+		return EncodingAuto, nil
+	case "utf8":
+		return EncodingUTF8, nil
+	case EncodingAuto, EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingUTF32LE, EncodingUTF32BE:
+		return e, nil
+	}
+
+	return "", fmt.Errorf("unknown encoding '%s'", name)
+}
+
+// DetectEncoding peeks at the start of the supplied *bufio.Reader and returns the encoding of the stream along with the
+// length of its byte order mark.  Streams without a byte order mark are detected using the pattern of zero bytes in
+// the first four bytes as described in RFC 4627, which relies on the first two characters of a json document being
+// ASCII.  No data is consumed from the reader.
+func DetectEncoding(br *bufio.Reader) (Encoding, int, error) {
+	start, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+
+	for _, bm := range byteOrderMarks {
+		if bytes.HasPrefix(start, bm.bom) {
+			return bm.encoding, len(bm.bom), nil
+		}
+	}
+
+	if len(start) == 4 {
+		switch {
+		case start[0] == 0 && start[1] == 0 && start[2] == 0 && start[3] != 0:
+			return EncodingUTF32BE, 0, nil
+		case start[0] != 0 && start[1] == 0 && start[2] == 0 && start[3] == 0:
+			return EncodingUTF32LE, 0, nil
+		}
+	}
+
+	if len(start) >= 2 {
+		switch {
+		case start[0] == 0 && start[1] != 0:
+			return EncodingUTF16BE, 0, nil
+		case start[0] != 0 && start[1] == 0:
+			return EncodingUTF16LE, 0, nil
+		}
+	}
+
+	return EncodingUTF8, 0, nil
+}
+
+// NewTranscodingReader returns an io.Reader which reads the supplied reader converting its data from the supplied
+// encoding to UTF-8.  Any byte order mark at the start of the stream is removed.  Characters which cannot be decoded
+// are replaced by U+FFFD.
+func NewTranscodingReader(rd io.Reader, e Encoding) (io.Reader, error) {
+	// a small buffer is enough to detect the encoding, and larger reads go straight to rd once it has been drained
+	br := bufio.NewReaderSize(rd, 16)
+
+	detected, bomLen, err := DetectEncoding(br)
+	if err != nil {
+		return nil, err
+	}
+
+	if e == "" || e == EncodingAuto {
+		e = detected
+	} else if detected != e {
+		// only strip a byte order mark belonging to the requested encoding
+		bomLen = 0
+	}
+
+	if bomLen > 0 {
+		_, err = br.Discard(bomLen)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch e {
+	case EncodingUTF8:
+		return br, nil
+	case EncodingUTF16LE:
+		return newTranscodingReader(br, 2, binary.LittleEndian), nil
+	case EncodingUTF16BE:
+		return newTranscodingReader(br, 2, binary.BigEndian), nil
+	case EncodingUTF32LE:
+		return newTranscodingReader(br, 4, binary.LittleEndian), nil
+	case EncodingUTF32BE:
+		return newTranscodingReader(br, 4, binary.BigEndian), nil
+	}
+
+	return nil, fmt.Errorf("unknown encoding '%s'", e)
+}
+
+// transcodingReader converts UTF-16 or UTF-32 to UTF-8
+type transcodingReader struct {
+	rd       io.Reader
+	unitSize int
+	order    binary.ByteOrder
+	err      error
+
+	// buf holds data read from rd. The first pending bytes have not been decoded yet
+	buf     []byte
+	pending int
+
+	// decoded holds UTF-8 which has not been returned by Read yet
+	decoded []byte
+	out     []byte
+}
+
+func newTranscodingReader(rd io.Reader, unitSize int, order binary.ByteOrder) *transcodingReader {
+	return &transcodingReader{
+		rd:       rd,
+		unitSize: unitSize,
+		order:    order,
+		buf:      make([]byte, transcodeBufferSize),
+		decoded:  make([]byte, 0, transcodeBufferSize),
+	}
+}
+
+// Read reads UTF-8 encoded data into p
+func (tr *transcodingReader) Read(p []byte) (int, error) {
+	for len(tr.out) == 0 {
+		if tr.err != nil {
+			return 0, tr.err
+		}
+
+		tr.fill()
+	}
+
+	n := copy(p, tr.out)
+	tr.out = tr.out[n:]
+	return n, nil
+}
+
+// fill reads from the underlying reader and decodes as much of the data read as possible
+func (tr *transcodingReader) fill() {
+	n, err := tr.rd.Read(tr.buf[tr.pending:])
+	tr.pending += n
+	if err != nil {
+		tr.err = err
+	}
+
+	var consumed int
+	if tr.unitSize == 2 {
+		tr.out, consumed = tr.decodeUTF16(tr.decoded[:0], tr.buf[:tr.pending], err != nil)
+	} else {
+		tr.out, consumed = tr.decodeUTF32(tr.decoded[:0], tr.buf[:tr.pending], err != nil)
+	}
+
+	tr.decoded = tr.out[:0]
+	tr.pending = copy(tr.buf, tr.buf[consumed:tr.pending])
+}
+
+// decodeUTF16 appends the UTF-8 encoding of data to dst returning the result and the number of bytes of data decoded.
+// Incomplete characters at the end of data are left to be decoded once more data has been read unless final is true.
+func (tr *transcodingReader) decodeUTF16(dst, data []byte, final bool) ([]byte, int) {
+	i := 0
+	for ; i+2 <= len(data); i += 2 {
+		r := rune(tr.order.Uint16(data[i:]))
+		if utf16.IsSurrogate(r) {
+			if i+4 > len(data) {
+				if !final {
+					break
+				}
+
+				r = utf8.RuneError
+			} else if pair := utf16.DecodeRune(r, rune(tr.order.Uint16(data[i+2:]))); pair != utf8.RuneError {
+				r = pair
+				i += 2
+			} else {
+				r = utf8.RuneError
+			}
+		}
+
+		dst = utf8.AppendRune(dst, r)
+	}
+
+	if final && i < len(data) {
+		dst = utf8.AppendRune(dst, utf8.RuneError)
+		i = len(data)
+	}
+
+	return dst, i
+}
+
+// decodeUTF32 appends the UTF-8 encoding of data to dst returning the result and the number of bytes of data decoded.
+// Incomplete characters at the end of data are left to be decoded once more data has been read unless final is true.
+func (tr *transcodingReader) decodeUTF32(dst, data []byte, final bool) ([]byte, int) {
+	i := 0
+	for ; i+4 <= len(data); i += 4 {
+		// utf8.AppendRune writes U+FFFD for surrogates and values beyond the unicode range
+		dst = utf8.AppendRune(dst, rune(tr.order.Uint32(data[i:])))
+	}
+
+	if final && i < len(data) {
+		dst = utf8.AppendRune(dst, utf8.RuneError)
+		i = len(data)
+	}
+
+	return dst, i
+}
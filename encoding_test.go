@@ -0,0 +1,158 @@
+package jsplit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/require"
+)
+
+const encodingTestDoc = `{"name": "café 😀", "items": [{"id": 1, "text": "日本"}, "𝄞"]}`
+
+// encodeTestDoc returns s encoded with the supplied encoding, prefixed with a byte order mark if bom is true
+func encodeTestDoc(s string, e Encoding, bom bool) []byte {
+	var order binary.AppendByteOrder = binary.LittleEndian
+	if e == EncodingUTF16BE || e == EncodingUTF32BE {
+		order = binary.BigEndian
+	}
+
+	var buf []byte
+	switch e {
+	case EncodingUTF8:
+		if bom {
+			buf = append(buf, 0xef, 0xbb, 0xbf)
+		}
+
+		return append(buf, s...)
+
+	case EncodingUTF16LE, EncodingUTF16BE:
+		units := utf16.Encode([]rune(s))
+		if bom {
+			units = append([]uint16{0xfeff}, units...)
+		}
+
+		for _, u := range units {
+			buf = order.AppendUint16(buf, u)
+		}
+
+	case EncodingUTF32LE, EncodingUTF32BE:
+		runes := []rune(s)
+		if bom {
+			runes = append([]rune{0xfeff}, runes...)
+		}
+
+		for _, r := range runes {
+			buf = order.AppendUint32(buf, uint32(r))
+		}
+	}
+
+	return buf
+}
+
+var allEncodings = []Encoding{EncodingUTF8, EncodingUTF16LE, EncodingUTF16BE, EncodingUTF32LE, EncodingUTF32BE}
+
+func TestDetectEncoding(t *testing.T) {
+	for _, e := range allEncodings {
+		for _, bom := range []bool{true, false} {
+			data := encodeTestDoc(encodingTestDoc, e, bom)
+			detected, bomLen, err := DetectEncoding(bufio.NewReader(bytes.NewReader(data)))
+			require.NoError(t, err)
+			require.Equal(t, e, detected)
+
+			if bom {
+				require.Equal(t, len(encodeTestDoc("", e, true)), bomLen)
+			} else {
+				require.Equal(t, 0, bomLen)
+			}
+		}
+	}
+
+	detected, bomLen, err := DetectEncoding(bufio.NewReader(bytes.NewReader([]byte("{"))))
+	require.NoError(t, err)
+	require.Equal(t, EncodingUTF8, detected)
+	require.Equal(t, 0, bomLen)
+}
+
+func TestNewTranscodingReader(t *testing.T) {
+	for _, e := range allEncodings {
+		for _, bom := range []bool{true, false} {
+			t.Run(string(e), func(t *testing.T) {
+				data := encodeTestDoc(encodingTestDoc, e, bom)
+
+				// reading a byte at a time splits characters and surrogate pairs across reads
+				for _, requested := range []Encoding{EncodingAuto, e} {
+					rd, err := NewTranscodingReader(iotest.OneByteReader(bytes.NewReader(data)), requested)
+					require.NoError(t, err)
+
+					decoded, err := io.ReadAll(rd)
+					require.NoError(t, err)
+					require.Equal(t, encodingTestDoc, string(decoded))
+				}
+			})
+		}
+	}
+}
+
+func TestTranscodingInvalidData(t *testing.T) {
+	// an unpaired high surrogate, an unpaired low surrogate and a truncated final code unit
+	data := []byte{'a', 0, 0x3d, 0xd8, 'b', 0, 0x00, 0xde, 'c'}
+	rd, err := NewTranscodingReader(bytes.NewReader(data), EncodingUTF16LE)
+	require.NoError(t, err)
+
+	decoded, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "a�b��", string(decoded))
+
+	// a value outside the unicode range
+	data = []byte{0, 0, 0, 'a', 0, 0x11, 0, 0}
+	rd, err = NewTranscodingReader(bytes.NewReader(data), EncodingUTF32BE)
+	require.NoError(t, err)
+
+	decoded, err = io.ReadAll(rd)
+	require.NoError(t, err)
+	require.Equal(t, "a�", string(decoded))
+}
+
+func TestParseEncoding(t *testing.T) {
+	e, err := ParseEncoding("")
+	require.NoError(t, err)
+	require.Equal(t, EncodingAuto, e)
+
+	e, err = ParseEncoding("UTF8")
+	require.NoError(t, err)
+	require.Equal(t, EncodingUTF8, e)
+
+	e, err = ParseEncoding("utf-16le")
+	require.NoError(t, err)
+	require.Equal(t, EncodingUTF16LE, e)
+
+	_, err = ParseEncoding("latin1")
+	require.Error(t, err)
+}
+
+func TestSplitterEncodings(t *testing.T) {
+	for _, e := range allEncodings {
+		t.Run(string(e), func(t *testing.T) {
+			tempDir := t.TempDir()
+			s, err := NewSplitter(SplitterOptions{
+				Reader:         bytes.NewReader(encodeTestDoc(encodingTestDoc, e, true)),
+				OutputDir:      tempDir,
+				ReadBufferSize: 5,
+			})
+			require.NoError(t, err)
+
+			err = s.Split(context.Background())
+			require.NoError(t, err)
+
+			requireContents(t, filepath.Join(tempDir, "root.json"), "{\n\t\"name\":\"café 😀\"\n}")
+			requireContents(t, filepath.Join(tempDir, "items_00.jsonl"), "{\"id\":1,\"text\":\"日本\"}\n\"𝄞\"")
+		})
+	}
+}
@@ -1,10 +1,11 @@
 module github.com/dolthub/jsplit
 
-go 1.18
+go 1.22
 
 require (
-	github.com/google/uuid v1.3.0
+	github.com/klauspost/compress v1.18.0
 	github.com/stretchr/testify v1.8.0
+	github.com/ulikunitz/xz v0.5.15
 )
 
 require (
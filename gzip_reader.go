@@ -0,0 +1,504 @@
+package jsplit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/flate"
+)
+
+const (
+	// gzipReadAheadSize is the size of the blocks of compressed data read ahead of decompression
+	gzipReadAheadSize = 1024 * 1024
+	// gzipReadAheadBlocks is the number of compressed blocks which may be read ahead of decompression
+	gzipReadAheadBlocks = 4
+	// gzipChunkSize is the size of the chunks of data decompressed from members which are decompressed as a stream
+	gzipChunkSize = 256 * 1024
+	// bgzfMaxBlockSize is the largest amount of data a BGZF member may hold once decompressed
+	bgzfMaxBlockSize = 64 * 1024
+)
+
+const (
+	gzipID1     = 0x1f
+	gzipID2     = 0x8b
+	gzipDeflate = 8
+
+	gzipFlagHdrCrc  = 1 << 1
+	gzipFlagExtra   = 1 << 2
+	gzipFlagName    = 1 << 3
+	gzipFlagComment = 1 << 4
+)
+
+var errGzipReaderClosed = errors.New("read from a closed gzip reader")
+
+// closedCh is a closed channel used as the done channel of results which are complete when they are created
+var closedCh = make(chan struct{})
+
+func init() {
+	close(closedCh)
+}
+
+// gzipResult is a piece of the decompressed output.  Results are queued in the order of the output before they are
+// complete, and done is closed once data and err have been set.
+type gzipResult struct {
+	data []byte
+	err  error
+	done chan struct{}
+}
+
+// gzipBlock is a member of a BGZF file which is decompressed by one of the decoder goroutines
+type gzipBlock struct {
+	// data holds the compressed data of the member followed by its 8 byte trailer
+	data   []byte
+	result *gzipResult
+}
+
+// crcWork is sent to the goroutine verifying the checksums of members decompressed as a stream.  Decompressed data is
+// added to the checksum of the current member, and a non-nil result holds the trailer of the member which is checked
+// once all of its data has been added.
+type crcWork struct {
+	data    []byte
+	trailer []byte
+	result  *gzipResult
+}
+
+// ParallelGzipReader decompresses gzip data, including data made of several concatenated members, using a pipeline of
+// goroutines.  Compressed data is read ahead of decompression, and the checksums of members are verified while later
+// data is decompressed.  Members of BGZF files, whose headers record their compressed size, are decompressed in
+// parallel by a pool of decoders.  Other members are decompressed one at a time as they must be decoded to find where
+// the next one starts.
+type ParallelGzipReader struct {
+	results chan *gzipResult
+	data    []byte
+	err     error
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewParallelGzipReader returns a *ParallelGzipReader which decompresses the gzip data read from rd, using up to
+// decoders goroutines to decompress BGZF members. Close must be called to stop its goroutines.  A read from rd which is
+// in progress when Close is called, such as one waiting on a stalled pipe, is not waited for. Its goroutine exits once
+// the read returns, discarding the data read, so rd should be closed after Close if it may block.
+func NewParallelGzipReader(rd io.Reader, decoders int) *ParallelGzipReader {
+	if decoders < 1 {
+		decoders = 1
+	}
+
+	pr := &ParallelGzipReader{
+		results: make(chan *gzipResult, 4*decoders+16),
+		stop:    make(chan struct{}),
+	}
+
+	blocks := make(chan *gzipBlock)
+	crcCh := make(chan crcWork, 64)
+	ra := newReadAheadReader(rd, pr.stop)
+
+	// the read ahead goroutine isn't part of wg, as Close can't interrupt a blocked read
+	go ra.run()
+
+	pr.wg.Add(decoders + 2)
+
+	go func() {
+		defer pr.wg.Done()
+		defer close(pr.results)
+		defer close(blocks)
+		defer close(crcCh)
+		pr.readMembers(bufio.NewReaderSize(ra, gzipReadAheadSize), blocks, crcCh)
+	}()
+
+	go func() {
+		defer pr.wg.Done()
+		verifyChecksums(crcCh)
+	}()
+
+	for i := 0; i < decoders; i++ {
+		go func() {
+			defer pr.wg.Done()
+			decodeBlocks(blocks)
+		}()
+	}
+
+	return pr
+}
+
+// Read reads decompressed data.  A corrupt member is reported as an error once the data preceding it has been read.
+func (pr *ParallelGzipReader) Read(p []byte) (int, error) {
+	for len(pr.data) == 0 {
+		if pr.err != nil {
+			return 0, pr.err
+		}
+
+		res, ok := <-pr.results
+		if !ok {
+			pr.err = io.EOF
+			continue
+		}
+
+		<-res.done
+		pr.data, pr.err = res.data, res.err
+	}
+
+	n := copy(p, pr.data)
+	pr.data = pr.data[n:]
+	return n, nil
+}
+
+// Close stops decompression and waits for the reader's goroutines to exit, other than one blocked reading from the
+// underlying reader
+func (pr *ParallelGzipReader) Close() error {
+	pr.stopOnce.Do(func() {
+		close(pr.stop)
+	})
+
+	pr.wg.Wait()
+	pr.data = nil
+	if pr.err == nil {
+		pr.err = errGzipReaderClosed
+	}
+
+	return nil
+}
+
+// send queues a result, returning false if the reader has been closed
+func (pr *ParallelGzipReader) send(res *gzipResult) bool {
+	select {
+	case pr.results <- res:
+		return true
+	case <-pr.stop:
+		return false
+	}
+}
+
+// readMembers reads each member of the gzip data in turn, queuing the results of each in order
+func (pr *ParallelGzipReader) readMembers(br *bufio.Reader, blocks chan<- *gzipBlock, crcCh chan<- crcWork) {
+	var fr io.ReadCloser
+	for first := true; ; first = false {
+		if !first {
+			// the data may end after any complete member
+			if _, err := br.Peek(1); err == io.EOF {
+				return
+			}
+		}
+
+		blockSize, err := readGzipHeader(br)
+		if err != nil {
+			pr.send(&gzipResult{err: err, done: closedCh})
+			return
+		}
+
+		if blockSize > 0 {
+			data := make([]byte, blockSize)
+			_, err = io.ReadFull(br, data)
+			if err != nil {
+				pr.send(&gzipResult{err: io.ErrUnexpectedEOF, done: closedCh})
+				return
+			}
+
+			block := &gzipBlock{data: data, result: &gzipResult{done: make(chan struct{})}}
+			if !pr.send(block.result) {
+				return
+			}
+
+			select {
+			case blocks <- block:
+			case <-pr.stop:
+				return
+			}
+
+			continue
+		}
+
+		if fr == nil {
+			fr = flate.NewReader(br)
+		} else {
+			_ = fr.(flate.Resetter).Reset(br, nil)
+		}
+
+		if !pr.inflateMember(fr, br, crcCh) {
+			return
+		}
+	}
+}
+
+// inflateMember decompresses a member as a stream, sending the decompressed data to be checksummed as it is queued. It
+// returns false if reading should stop.
+func (pr *ParallelGzipReader) inflateMember(fr io.Reader, br *bufio.Reader, crcCh chan<- crcWork) bool {
+	for {
+		buf := make([]byte, gzipChunkSize)
+		n := 0
+		var err error
+		for n < len(buf) && err == nil {
+			var read int
+			read, err = fr.Read(buf[n:])
+			n += read
+		}
+
+		if n > 0 {
+			crcCh <- crcWork{data: buf[:n]}
+			if !pr.send(&gzipResult{data: buf[:n], done: closedCh}) {
+				return false
+			}
+		}
+
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			pr.send(&gzipResult{err: err, done: closedCh})
+			return false
+		}
+	}
+
+	trailer := make([]byte, 8)
+	_, err := io.ReadFull(br, trailer)
+	if err != nil {
+		pr.send(&gzipResult{err: io.ErrUnexpectedEOF, done: closedCh})
+		return false
+	}
+
+	res := &gzipResult{done: make(chan struct{})}
+	crcCh <- crcWork{trailer: trailer, result: res}
+	return pr.send(res)
+}
+
+// verifyChecksums checksums the data of members decompressed as a stream, completing the result sent with the trailer
+// of each member
+func verifyChecksums(crcCh <-chan crcWork) {
+	var crc, size uint32
+	for work := range crcCh {
+		if work.result == nil {
+			crc = crc32.Update(crc, crc32.IEEETable, work.data)
+			size += uint32(len(work.data))
+			continue
+		}
+
+		if binary.LittleEndian.Uint32(work.trailer) != crc || binary.LittleEndian.Uint32(work.trailer[4:]) != size {
+			work.result.err = gzip.ErrChecksum
+		}
+
+		close(work.result.done)
+		crc, size = 0, 0
+	}
+}
+
+// decodeBlocks decompresses and checksums BGZF members until the channel is closed
+func decodeBlocks(blocks <-chan *gzipBlock) {
+	var fr io.ReadCloser
+	for block := range blocks {
+		compressed, trailer := block.data[:len(block.data)-8], block.data[len(block.data)-8:]
+		if fr == nil {
+			fr = flate.NewReader(bytes.NewReader(compressed))
+		} else {
+			_ = fr.(flate.Resetter).Reset(bytes.NewReader(compressed), nil)
+		}
+
+		res := block.result
+		size := binary.LittleEndian.Uint32(trailer[4:])
+		if size > bgzfMaxBlockSize {
+			// the size is checked before the data is allocated as a corrupt trailer could hold any size up to 4GiB
+			res.err = gzip.ErrChecksum
+			close(res.done)
+			continue
+		}
+
+		data := make([]byte, size)
+		_, err := io.ReadFull(fr, data)
+		if err == nil {
+			// the data must end where the trailer says it does
+			var extra [1]byte
+			if n, _ := fr.Read(extra[:]); n != 0 {
+				err = gzip.ErrChecksum
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = gzip.ErrChecksum
+		}
+
+		if err == nil && crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(trailer) {
+			err = gzip.ErrChecksum
+		}
+
+		if err != nil {
+			res.err = err
+		} else {
+			res.data = data
+		}
+
+		close(res.done)
+	}
+}
+
+// readGzipHeader reads the header of a gzip member as described in RFC 1952.  If the member is a BGZF block, whose
+// extra field records the size of the member, the number of bytes remaining in the member is returned, otherwise it
+// returns 0.
+func readGzipHeader(br *bufio.Reader) (int, error) {
+	var hdr [10]byte
+	_, err := io.ReadFull(br, hdr[:])
+	if err != nil {
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		return 0, err
+	}
+
+	if hdr[0] != gzipID1 || hdr[1] != gzipID2 || hdr[2] != gzipDeflate {
+		return 0, gzip.ErrHeader
+	}
+
+	flags := hdr[3]
+	digest := crc32.ChecksumIEEE(hdr[:])
+	headerLen := len(hdr)
+	blockSize := 0
+
+	read := func(n int) ([]byte, error) {
+		buf := make([]byte, n)
+		_, err := io.ReadFull(br, buf)
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		digest = crc32.Update(digest, crc32.IEEETable, buf)
+		headerLen += n
+		return buf, nil
+	}
+
+	if flags&gzipFlagExtra != 0 {
+		xlen, err := read(2)
+		if err != nil {
+			return 0, err
+		}
+
+		extra, err := read(int(binary.LittleEndian.Uint16(xlen)))
+		if err != nil {
+			return 0, err
+		}
+
+		// subfields are made of a two byte identifier, a two byte length and the data. BGZF uses the BC subfield to
+		// record the total size of the member minus 1.
+		for len(extra) >= 4 {
+			size := int(binary.LittleEndian.Uint16(extra[2:]))
+			if 4+size > len(extra) {
+				break
+			}
+
+			if extra[0] == 'B' && extra[1] == 'C' && size == 2 {
+				blockSize = int(binary.LittleEndian.Uint16(extra[4:])) + 1
+			}
+
+			extra = extra[4+size:]
+		}
+	}
+
+	for _, flag := range []byte{gzipFlagName, gzipFlagComment} {
+		if flags&flag == 0 {
+			continue
+		}
+
+		s, err := br.ReadBytes(0)
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+
+		digest = crc32.Update(digest, crc32.IEEETable, s)
+		headerLen += len(s)
+	}
+
+	if flags&gzipFlagHdrCrc != 0 {
+		want := uint16(digest)
+		hcrc, err := read(2)
+		if err != nil {
+			return 0, err
+		}
+
+		if binary.LittleEndian.Uint16(hcrc) != want {
+			return 0, gzip.ErrHeader
+		}
+	}
+
+	if blockSize == 0 {
+		return 0, nil
+	}
+
+	// the remainder of a BGZF member is the compressed data and the 8 byte trailer
+	if blockSize < headerLen+8 {
+		return 0, gzip.ErrHeader
+	}
+
+	return blockSize - headerLen, nil
+}
+
+// readAheadReader reads blocks of data from an io.Reader on its own goroutine so that reading overlaps with the
+// processing of earlier blocks
+type readAheadReader struct {
+	rd     io.Reader
+	blocks chan readAheadBlock
+	stop   <-chan struct{}
+
+	data []byte
+	err  error
+}
+
+type readAheadBlock struct {
+	data []byte
+	err  error
+}
+
+func newReadAheadReader(rd io.Reader, stop <-chan struct{}) *readAheadReader {
+	return &readAheadReader{
+		rd:     rd,
+		blocks: make(chan readAheadBlock, gzipReadAheadBlocks),
+		stop:   stop,
+	}
+}
+
+// run reads from the underlying reader until it is exhausted, an error occurs, or reading is stopped
+func (ra *readAheadReader) run() {
+	defer close(ra.blocks)
+	for {
+		buf := make([]byte, gzipReadAheadSize)
+		n, err := ra.rd.Read(buf)
+		if n > 0 || err != nil {
+			select {
+			case ra.blocks <- readAheadBlock{data: buf[:n], err: err}:
+			case <-ra.stop:
+				return
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (ra *readAheadReader) Read(p []byte) (int, error) {
+	for len(ra.data) == 0 {
+		if ra.err != nil {
+			return 0, ra.err
+		}
+
+		select {
+		case block, ok := <-ra.blocks:
+			if !ok {
+				ra.err = errGzipReaderClosed
+			} else {
+				ra.data, ra.err = block.data, block.err
+			}
+		case <-ra.stop:
+			ra.err = errGzipReaderClosed
+		}
+	}
+
+	n := copy(p, ra.data)
+	ra.data = ra.data[n:]
+	return n, nil
+}
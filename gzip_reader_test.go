@@ -0,0 +1,206 @@
+package jsplit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math/rand"
+	"strconv"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// gzipTestData returns compressible data of the supplied size
+func gzipTestData(size int) []byte {
+	rng := rand.New(rand.NewSource(int64(size)))
+	data := make([]byte, 0, size+32)
+	for len(data) < size {
+		data = append(data, `{"id": `...)
+		data = strconv.AppendInt(data, rng.Int63n(1000000), 10)
+		data = append(data, "},\n"...)
+	}
+
+	return data[:size]
+}
+
+func gzipMember(t *testing.T, data []byte, hdr gzip.Header) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Header = hdr
+	_, err := gw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+// bgzf compresses data as a BGZF file, made of members holding up to blockSize bytes of data whose extra field records
+// the size of the member, followed by the empty end of file member
+func bgzf(t *testing.T, data []byte, blockSize int) []byte {
+	var out []byte
+	for {
+		n := blockSize
+		if n > len(data) {
+			n = len(data)
+		}
+
+		member := gzipMember(t, data[:n], gzip.Header{Extra: []byte{'B', 'C', 2, 0, 0, 0}})
+		// the extra field follows the 10 byte header and 2 byte length
+		binary.LittleEndian.PutUint16(member[16:], uint16(len(member)-1))
+		out = append(out, member...)
+		data = data[n:]
+
+		if n == 0 {
+			return out
+		}
+	}
+}
+
+func readGzip(compressed []byte, decoders int) ([]byte, error) {
+	pr := NewParallelGzipReader(iotest.HalfReader(bytes.NewReader(compressed)), decoders)
+	defer pr.Close()
+	return io.ReadAll(iotest.OneByteReader(io.LimitReader(pr, 1<<62)))
+}
+
+func TestParallelGzipReader(t *testing.T) {
+	data := gzipTestData(3*gzipChunkSize + 17)
+
+	tests := []struct {
+		name       string
+		compressed []byte
+		expected   []byte
+	}{
+		{
+			name:       "single member",
+			compressed: gzipMember(t, data, gzip.Header{}),
+			expected:   data,
+		},
+		{
+			name:       "header fields",
+			compressed: gzipMember(t, data[:100], gzip.Header{Name: "data.json", Comment: "test", Extra: []byte{'X', 'Y', 1, 0, 7}}),
+			expected:   data[:100],
+		},
+		{
+			name:       "empty",
+			compressed: gzipMember(t, nil, gzip.Header{}),
+			expected:   []byte{},
+		},
+		{
+			name:       "multiple members",
+			compressed: append(append(gzipMember(t, data[:1000], gzip.Header{}), gzipMember(t, nil, gzip.Header{})...), gzipMember(t, data[1000:], gzip.Header{})...),
+			expected:   data,
+		},
+		{
+			name:       "bgzf",
+			compressed: bgzf(t, data, 65280),
+			expected:   data,
+		},
+		{
+			name:       "bgzf followed by a stream",
+			compressed: append(bgzf(t, data[:70000], 4096), gzipMember(t, data[70000:], gzip.Header{})...),
+			expected:   data,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, decoders := range []int{1, 4} {
+				actual, err := readGzip(test.compressed, decoders)
+				require.NoError(t, err)
+				require.Equal(t, test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParallelGzipReaderErrors(t *testing.T) {
+	data := gzipTestData(100000)
+
+	corrupt := func(compressed []byte, i int) []byte {
+		compressed = append([]byte(nil), compressed...)
+		compressed[i] ^= 0xff
+		return compressed
+	}
+
+	stream := gzipMember(t, data, gzip.Header{})
+	blocks := bgzf(t, data, 10000)
+
+	withHeaderCRC := gzipMember(t, data[:10], gzip.Header{})
+	withHeaderCRC[3] |= gzipFlagHdrCrc
+	withHeaderCRC = append(withHeaderCRC[:10:10], append([]byte{0, 0}, withHeaderCRC[10:]...)...)
+
+	tests := []struct {
+		name       string
+		compressed []byte
+		err        error
+	}{
+		{name: "stream crc", compressed: corrupt(stream, len(stream)-8), err: gzip.ErrChecksum},
+		{name: "stream size", compressed: corrupt(stream, len(stream)-1), err: gzip.ErrChecksum},
+		{name: "stream truncated", compressed: stream[:len(stream)-4], err: io.ErrUnexpectedEOF},
+		{name: "bgzf crc", compressed: corrupt(blocks, int(binary.LittleEndian.Uint16(blocks[16:]))+1-8), err: gzip.ErrChecksum},
+		// the top byte of the size in the trailer of the first block is corrupted, claiming almost 4GiB of data
+		{name: "bgzf size", compressed: corrupt(blocks, int(binary.LittleEndian.Uint16(blocks[16:]))), err: gzip.ErrChecksum},
+		{name: "bgzf truncated", compressed: blocks[:len(blocks)-100], err: io.ErrUnexpectedEOF},
+		{name: "trailing garbage", compressed: append(append([]byte(nil), stream...), "trailing garbage"...), err: gzip.ErrHeader},
+		{name: "not gzip", compressed: []byte("not gzip data"), err: gzip.ErrHeader},
+		{name: "header crc", compressed: withHeaderCRC, err: gzip.ErrHeader},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := readGzip(test.compressed, 2)
+			require.ErrorIs(t, err, test.err)
+		})
+	}
+}
+
+func TestParallelGzipReaderClose(t *testing.T) {
+	data := gzipTestData(4 * gzipChunkSize)
+
+	for _, compressed := range [][]byte{gzipMember(t, data, gzip.Header{}), bgzf(t, data, 1000)} {
+		pr := NewParallelGzipReader(bytes.NewReader(compressed), 2)
+		buf := make([]byte, 100)
+		_, err := io.ReadFull(pr, buf)
+		require.NoError(t, err)
+		require.Equal(t, data[:100], buf)
+
+		// closing before the data has been read stops the goroutines without waiting for the data to be consumed
+		require.NoError(t, pr.Close())
+		_, err = pr.Read(buf)
+		require.Error(t, err)
+	}
+}
+
+func TestParallelGzipReaderCloseStalled(t *testing.T) {
+	data := gzipTestData(4 * gzipChunkSize)
+	compressed := gzipMember(t, data, gzip.Header{})
+
+	// the pipe delivers part of the data and then stalls, as stdin can
+	pipeRd, pipeWr := io.Pipe()
+	go func() {
+		_, _ = pipeWr.Write(compressed[:len(compressed)/2])
+	}()
+
+	pr := NewParallelGzipReader(pipeRd, 2)
+	buf := make([]byte, 100)
+	_, err := io.ReadFull(pr, buf)
+	require.NoError(t, err)
+
+	closed := make(chan error)
+	go func() {
+		closed <- pr.Close()
+	}()
+
+	select {
+	case err = <-closed:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		require.Fail(t, "Close is waiting for the stalled read")
+	}
+
+	// closing the pipe ends the read which was in progress
+	require.NoError(t, pipeRd.Close())
+}
@@ -0,0 +1,250 @@
+// Package docgen generates synthetic json documents of varying shapes, used to benchmark jsplit and by the jsplit-gen
+// command to create test inputs.  Documents are generated deterministically from a seed so that benchmark results can
+// be compared between runs.
+package docgen
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Shape identifies the structure of a generated document
+type Shape string
+
+const (
+	// ShapeTiny is a document with lists of many small objects
+	ShapeTiny Shape = "tiny"
+	// ShapeHuge is a document with a list of a few very large objects
+	ShapeHuge Shape = "huge"
+	// ShapeDeep is a document with a list of deeply nested objects and lists
+	ShapeDeep Shape = "deep"
+	// ShapeStrings is a document with a list of objects holding long strings containing escapes and multibyte
+	// characters
+	ShapeStrings Shape = "strings"
+)
+
+// Shapes lists every supported Shape
+var Shapes = []Shape{ShapeTiny, ShapeHuge, ShapeDeep, ShapeStrings}
+
+// hugeItems is the number of items in the list of a ShapeHuge document
+const hugeItems = 4
+
+// deepDepth is the depth the items of a ShapeDeep document are nested to
+const deepDepth = 64
+
+// ParseShape converts the name of a shape to a Shape
+func ParseShape(name string) (Shape, error) {
+	for _, s := range Shapes {
+		if Shape(strings.ToLower(name)) == s {
+			return s, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown shape '%s'", name)
+}
+
+// generator writes a document, keeping count of the bytes written
+type generator struct {
+	wr  *bufio.Writer
+	rng *rand.Rand
+	n   int64
+	err error
+	// indent puts each list item on its own indented line
+	indent bool
+}
+
+func (g *generator) str(s string) {
+	n, err := g.wr.WriteString(s)
+	g.n += int64(n)
+	if err != nil && g.err == nil {
+		g.err = err
+	}
+}
+
+// more returns true while the document is smaller than size and nothing has failed to be written
+func (g *generator) more(size int64) bool {
+	return g.n < size && g.err == nil
+}
+
+func (g *generator) int(i int) {
+	g.str(strconv.Itoa(i))
+}
+
+func (g *generator) newline(depth int) {
+	if g.indent {
+		g.str("\n" + strings.Repeat("  ", depth))
+	}
+}
+
+// list writes a list whose items are written by item until the document reaches size bytes or maxItems items have
+// been written.  A maxItems of 0 is unlimited.
+func (g *generator) list(size int64, maxItems int, item func(i int)) {
+	g.str("[")
+	for i := 0; (maxItems == 0 || i < maxItems) && g.more(size); i++ {
+		if i > 0 {
+			g.str(",")
+		}
+
+		g.newline(2)
+		item(i)
+	}
+
+	g.newline(1)
+	g.str("]")
+}
+
+var words = []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing", "elit", "sed", "do"}
+
+// escapes are the escape sequences and multibyte characters mixed into the text of ShapeStrings documents
+var escapes = []string{`\"`, `\\`, `\n`, `\t`, `\/`, `\u00e9`, `\ud83d\ude00`, "é", "日本", "😀"}
+
+func (g *generator) text(length int) {
+	g.str(`"`)
+	for written := 0; written < length; {
+		s := words[g.rng.Intn(len(words))]
+		if g.rng.Intn(8) == 0 {
+			s = escapes[g.rng.Intn(len(escapes))]
+		}
+
+		g.str(s)
+		g.str(" ")
+		written += len(s) + 1
+	}
+	g.str(`"`)
+}
+
+func (g *generator) tinyItem(i int) {
+	g.str(`{"id":`)
+	g.int(i)
+	g.str(`,"ok":`)
+	g.str(strconv.FormatBool(g.rng.Intn(2) == 0))
+	g.str(`,"v":`)
+	g.int(g.rng.Intn(1000))
+	g.str(`}`)
+}
+
+func (g *generator) hugeItem(i int, size int64) {
+	g.str(`{"id":`)
+	g.int(i)
+	g.str(`,"values":[`)
+	for j := 0; g.more(size); j++ {
+		if j > 0 {
+			g.str(",")
+		}
+
+		g.str(`{"x":`)
+		g.int(g.rng.Intn(1000000))
+		g.str(`,"y":`)
+		g.str(strconv.FormatFloat(g.rng.Float64(), 'f', 6, 64))
+		g.str(`,"label":"value `)
+		g.int(j)
+		g.str(`"}`)
+	}
+	g.str(`]}`)
+}
+
+func (g *generator) deepItem(i int) {
+	for d := 0; d < deepDepth; d++ {
+		if d%2 == 0 {
+			g.str(`{"level":`)
+			g.int(d)
+			g.str(`,"child":`)
+		} else {
+			g.str(`[`)
+			g.int(i)
+			g.str(`,"sibling",`)
+		}
+	}
+
+	g.str(`null`)
+	for d := deepDepth - 1; d >= 0; d-- {
+		if d%2 == 0 {
+			g.str(`}`)
+		} else {
+			g.str(`]`)
+		}
+	}
+}
+
+func (g *generator) stringsItem(i int) {
+	g.str(`{"id":`)
+	g.int(i)
+	g.str(`,"title":`)
+	g.text(32)
+	g.str(`,"body":`)
+	g.text(1024 + g.rng.Intn(8*1024))
+	g.str(`}`)
+}
+
+// Generate writes a document of the specified shape to wr.  The document is a json object holding a few scalar values
+// and lists, and is slightly larger than size bytes as the item which takes it past size is completed.  When indent is
+// true the list items are written on separate indented lines.
+func Generate(wr io.Writer, shape Shape, size int64, seed int64, indent bool) error {
+	if !slices.Contains(Shapes, shape) {
+		return fmt.Errorf("unknown shape '%s'", shape)
+	}
+
+	g := &generator{
+		wr:     bufio.NewWriter(wr),
+		rng:    rand.New(rand.NewSource(seed)),
+		indent: indent,
+	}
+
+	g.str(`{`)
+	g.newline(1)
+	g.str(`"shape":"`)
+	g.str(string(shape))
+	g.str(`","seed":`)
+	g.int(int(seed))
+	g.str(`,`)
+	g.newline(1)
+
+	switch shape {
+	case ShapeTiny:
+		// the items are split between two lists so that switching between lists is covered
+		g.str(`"events":`)
+		g.list(size/2, 0, g.tinyItem)
+		g.str(`,`)
+		g.newline(1)
+		g.str(`"metrics":`)
+		g.list(size, 0, g.tinyItem)
+
+	case ShapeHuge:
+		g.str(`"records":`)
+		g.list(size, hugeItems, func(i int) {
+			g.hugeItem(i, size*int64(i+1)/hugeItems)
+		})
+
+	case ShapeDeep:
+		g.str(`"trees":`)
+		g.list(size, 0, g.deepItem)
+
+	case ShapeStrings:
+		g.str(`"documents":`)
+		g.list(size, 0, g.stringsItem)
+	}
+
+	g.newline(0)
+	g.str("}\n")
+	if g.err != nil {
+		return g.err
+	}
+
+	return g.wr.Flush()
+}
+
+// GenerateBytes returns a document generated by Generate
+func GenerateBytes(shape Shape, size int64, seed int64, indent bool) []byte {
+	var buf bytes.Buffer
+	if err := Generate(&buf, shape, size, seed, indent); err != nil {
+		panic(err)
+	}
+
+	return buf.Bytes()
+}
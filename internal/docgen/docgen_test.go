@@ -0,0 +1,44 @@
+package docgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	const size = 256 * 1024
+
+	for _, shape := range Shapes {
+		for _, indent := range []bool{false, true} {
+			doc := GenerateBytes(shape, size, 1, indent)
+			require.True(t, json.Valid(doc), "%s", shape)
+			require.GreaterOrEqual(t, len(doc), size)
+
+			var root map[string]interface{}
+			require.NoError(t, json.Unmarshal(doc, &root))
+			require.Equal(t, string(shape), root["shape"])
+
+			// documents are generated deterministically from the seed
+			require.Equal(t, doc, GenerateBytes(shape, size, 1, indent))
+			require.NotEqual(t, doc, GenerateBytes(shape, size, 2, indent))
+		}
+	}
+}
+
+func TestGenerateUnknownShape(t *testing.T) {
+	var buf bytes.Buffer
+	require.Error(t, Generate(&buf, "unknown", 100, 1, false))
+	require.Zero(t, buf.Len())
+}
+
+func TestParseShape(t *testing.T) {
+	shape, err := ParseShape("Deep")
+	require.NoError(t, err)
+	require.Equal(t, ShapeDeep, shape)
+
+	_, err = ParseShape("wide")
+	require.Error(t, err)
+}
@@ -1,11 +1,13 @@
-package main
+package jsplit
 
 import (
+	"bytes"
 	"context"
-	"errors"
-	"fmt"
+	"encoding/json"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 )
 
@@ -24,6 +26,9 @@ const (
 	COMMA   = byte(',')
 )
 
+// ListAddFunc is called with each item of a list being split.  The item is only valid until the function returns.
+type ListAddFunc func(item []byte) error
+
 var isOpen []bool
 var isWhitespace []bool
 
@@ -51,47 +56,87 @@ func SkipWhitespace(itr *BufferedByteStreamIter) {
 		}
 	}
 
-	if ch != 0 {
+	if ch != 0 || !itr.eof {
 		itr.Advance(-1)
 	}
 
 	itr.Value()
 }
 
+// PeekNext returns the first non-whitespace character without consuming it, or 0 if the iterator has been exhausted
+func PeekNext(itr *BufferedByteStreamIter) byte {
+	SkipWhitespace(itr)
+	ch := itr.Next()
+	if ch != 0 || !itr.eof {
+		itr.Advance(-1)
+	}
+
+	return ch
+}
+
 // IsNext returns an error if the first non-whitespace character is different than expected.
 func IsNext(itr *BufferedByteStreamIter, expected byte) error {
 	SkipWhitespace(itr)
 	ch := itr.Next()
 	if ch != expected {
-		return fmt.Errorf("expected '%v' found '%v'", rune(ch), rune(expected))
+		return newSyntaxError(itr, ch, "expected %s found %s", describeByte(expected), describeByte(ch))
 	}
 
 	return nil
 }
 
-// ParseUntil reads from the iterator until the specified byte is found
+// ParseUntil reads from the iterator until the specified byte is found.  Bytes escaped with a backslash are skipped, so
+// the quote in \" is skipped while the quote following an escaped backslash, as in \\", is found.
 func ParseUntil(itr *BufferedByteStreamIter, findCh byte) ([]byte, error) {
-	var prev byte
+	escaped := false
 	for {
 		ch := itr.Next()
 		if ch == 0 {
-			return nil, fmt.Errorf("unexpected eof found while looking for '%v'", string(ch))
-		} else if ch == findCh && prev != Escape {
+			return nil, newSyntaxError(itr, ch, "unexpected EOF found while looking for %s", describeByte(findCh))
+		} else if escaped {
+			escaped = false
+		} else if ch == Escape {
+			escaped = true
+		} else if ch == findCh {
 			return itr.Value(), nil
 		}
-
-		prev = ch
 	}
 }
 
+// Parser parses json read from a BufferedByteStreamIter.  The zero value is a lenient parser which accepts some
+// invalid json, such as trailing commas and unquoted tokens, passing it through unchanged.  All of the state used while
+// parsing is held by the Parser, so separate Parsers may be used from separate goroutines, but a single Parser must not
+// be used concurrently.
+type Parser struct {
+	// Strict enables full validation of the json being parsed as defined by RFC 8259.  Literals, numbers, string
+	// escapes and structure are validated and the first violation is returned as a *SyntaxError.
+	Strict bool
+	// ControlChars controls how raw control characters inside strings are handled when Strict is false. The zero value
+	// behaves as ControlCharEscape. Strict parsing always rejects them.
+	ControlChars ControlCharMode
+
+	v validator
+	// objBuf holds the compacted output of ParseObject and is reused by each call
+	objBuf []byte
+	// openStack tracks the strings, objects and lists which are open while ParseObject is scanning
+	openStack ByteStack
+	// noIndex disables the structural index so that json is always scanned a byte at a time
+	noIndex bool
+}
+
 // ParseKey will parse a json key from the iterator
 func ParseKey(itr *BufferedByteStreamIter) ([]byte, error) {
+	return (&Parser{}).ParseKey(itr)
+}
+
+// ParseKey will parse a json key from the iterator
+func (p *Parser) ParseKey(itr *BufferedByteStreamIter) ([]byte, error) {
 	err := IsNext(itr, QM)
 	if err != nil {
 		return nil, err
 	}
 
-	key, err := ParseUntil(itr, QM)
+	key, err := p.parseString(itr)
 	if err != nil {
 		return nil, err
 	}
@@ -104,12 +149,96 @@ func ParseKey(itr *BufferedByteStreamIter) ([]byte, error) {
 	return key, nil
 }
 
-var parseObjBuffer = make([]byte, 128*1024)
+// parseString reads a string whose opening quote has already been read, returning the string including its quotes
+func (p *Parser) parseString(itr *BufferedByteStreamIter) ([]byte, error) {
+	if !p.Strict {
+		return p.parseLenientString(itr)
+	}
+
+	p.v.reset()
+	p.v.step(QM)
+	for {
+		ch := itr.Next()
+		if ch == 0 {
+			return nil, newSyntaxError(itr, ch, "unexpected EOF found while parsing string")
+		} else if msg := p.v.step(ch); len(msg) != 0 {
+			return nil, newSyntaxError(itr, ch, "%s", msg)
+		} else if p.v.state == vsDone {
+			return itr.Value(), nil
+		}
+	}
+}
 
-// ParseObject parses a json struct or list. It is non-reentrant and not thread safe due to it's use of parseObjBuffer.
-// Could swap for a sync pool to make it so.  Also a reference to the returned data should not be stored as the data may
-// change when ParseObject is called again
+// parseLenientString reads a string whose opening quote has already been read, handling any raw control characters it
+// contains as specified by ControlChars
+func (p *Parser) parseLenientString(itr *BufferedByteStreamIter) ([]byte, error) {
+	escaped := false
+	hasControlChars := false
+	// byteScan counts the bytes left to scan a byte at a time before trying the structural index again
+	byteScan := 0
+	for {
+		if byteScan == 0 && !p.noIndex {
+			if available := len(itr.buffer) - itr.pos; available < blockSize {
+				byteScan = max(available, 1)
+			} else {
+				n, found, ok := scanStringBlock(itr.buffer[itr.pos:itr.pos+blockSize], &escaped)
+				itr.pos += n
+				if found {
+					return lenientStringValue(itr, hasControlChars), nil
+				} else if ok {
+					continue
+				}
+
+				byteScan = blockSize
+			}
+		}
+
+		byteScan--
+		ch := itr.Next()
+		switch {
+		case ch == 0:
+			return nil, newSyntaxError(itr, ch, "unexpected EOF found while parsing string")
+
+		case ch < 0x20:
+			if p.ControlChars == ControlCharReject {
+				return nil, newSyntaxError(itr, ch, "invalid control character %s in string", describeByte(ch))
+			}
+
+			hasControlChars = p.ControlChars != ControlCharPreserve
+			escaped = false
+
+		case escaped:
+			escaped = false
+
+		case ch == Escape:
+			escaped = true
+
+		case ch == QM:
+			return lenientStringValue(itr, hasControlChars), nil
+		}
+	}
+}
+
+// lenientStringValue returns the string ending at the current position, escaping the raw control characters it contains
+// when hasControlChars is set
+func lenientStringValue(itr *BufferedByteStreamIter, hasControlChars bool) []byte {
+	if hasControlChars {
+		return escapeControlChars(itr.Value())
+	}
+
+	return itr.Value()
+}
+
+// ParseObject parses a json struct or list using a new lenient Parser
 func ParseObject(itr *BufferedByteStreamIter) ([]byte, error) {
+	return (&Parser{}).ParseObject(itr)
+}
+
+// ParseObject parses a json struct or list, returning it with the whitespace outside of strings removed unless a lenient
+// Parser is preserving control characters, in which case it is returned exactly as it was read.  The returned
+// data is held in a buffer owned by the Parser, so a reference to it should not be stored as the data will change when
+// ParseObject is called again.
+func (p *Parser) ParseObject(itr *BufferedByteStreamIter) ([]byte, error) {
 	SkipWhitespace(itr)
 	ch := itr.Next()
 	var closeCh byte
@@ -119,47 +248,105 @@ func ParseObject(itr *BufferedByteStreamIter) ([]byte, error) {
 	case OpenSB:
 		closeCh = CloseSB
 	default:
-		return nil, fmt.Errorf("unexpected char '%v' found while looking for '{'", string(ch))
+		return nil, newSyntaxError(itr, ch, "unexpected %s found while looking for '{' or '['", describeByte(ch))
 	}
 
-	parseObjBuffer = parseObjBuffer[:1]
-	parseObjBuffer[0] = ch
+	p.objBuf = append(p.objBuf[:0], ch)
 
-	var prev byte
+	if p.Strict {
+		p.v.reset()
+		p.v.step(ch)
+	}
+
+	// escaped is true when the previous byte within a string was an unescaped backslash
+	escaped := false
 	var lastOpen byte
-	openStack := NewByteStack()
+	openStack := &p.openStack
+	openStack.Reset()
+	// the structural index is used for the lenient parser only, and byteScan counts the bytes left to scan a byte at a
+	// time before trying it again
+	useIndex := !p.Strict && !p.noIndex
+	// the lenient parser copies the whitespace between values as well as the contents of strings when preserving
+	preserve := !p.Strict && p.ControlChars == ControlCharPreserve
+	byteScan := 0
 	for {
+		if byteScan == 0 && useIndex {
+			if available := len(itr.buffer) - itr.pos; available < blockSize {
+				byteScan = max(available, 1)
+			} else {
+				// the index tracks whether it is within a string itself, so the open string is taken off the stack
+				inString := lastOpen == QM
+				if inString {
+					openStack.Pop()
+				}
+
+				n, closed, ok := p.scanObjectBlock(itr.buffer[itr.pos:itr.pos+blockSize], closeCh, &inString, &escaped)
+				itr.pos += n
+				if closed {
+					return p.objBuf, nil
+				}
+
+				if inString {
+					openStack.Push(QM)
+				}
+
+				lastOpen = openStack.Peek()
+				if ok {
+					continue
+				}
+
+				byteScan = blockSize
+			}
+		}
+
+		byteScan--
 		ch := itr.Next()
 		if ch == 0 {
-			return nil, errors.New("unexpected EOF found while parsing object")
+			return nil, newSyntaxError(itr, ch, "unexpected EOF found while parsing object")
 		}
 
-		if isWhitespace[ch] {
-			if lastOpen == QM {
-				if ch == CR {
-					parseObjBuffer = append(parseObjBuffer, Escape, Escape, byte('r'))
-				} else if ch == LF {
-					parseObjBuffer = append(parseObjBuffer, Escape, Escape, byte('n'))
-				} else {
-					parseObjBuffer = append(parseObjBuffer, ch)
-				}
+		if p.Strict {
+			if msg := p.v.step(ch); len(msg) != 0 {
+				return nil, newSyntaxError(itr, ch, "%s", msg)
+			}
+		}
+
+		if lastOpen == QM && ch < 0x20 {
+			switch p.ControlChars {
+			case ControlCharReject:
+				return nil, newSyntaxError(itr, ch, "invalid control character %s in string", describeByte(ch))
+			case ControlCharPreserve:
+				p.objBuf = append(p.objBuf, ch)
+			default:
+				p.objBuf = appendEscapedControlChar(p.objBuf, ch)
 			}
 
+			escaped = false
+			continue
+		} else if isWhitespace[ch] && lastOpen != QM && !preserve {
 			continue
 		}
 
-		parseObjBuffer = append(parseObjBuffer, ch)
+		p.objBuf = append(p.objBuf, ch)
 		switch lastOpen {
 		case 0:
 			if ch == closeCh {
-				return parseObjBuffer, nil
+				if p.Strict && p.v.state != vsDone {
+					return nil, newSyntaxError(itr, ch, "unexpected %s found while parsing object", describeByte(ch))
+				}
+
+				return p.objBuf, nil
 			} else if isOpen[ch] {
 				openStack.Push(ch)
 				lastOpen = ch
 			}
 
 		case QM:
-			if ch == QM && prev != Escape {
+			if escaped {
+				escaped = false
+			} else if ch == Escape {
+				escaped = true
+			} else if ch == QM {
 				openStack.Pop()
 				lastOpen = openStack.Peek()
 			}
@@ -183,10 +370,8 @@ func ParseObject(itr *BufferedByteStreamIter) ([]byte, error) {
 			}
 
 		default:
-			return nil, fmt.Errorf("unknown opening character '%v'", string(ch))
+			return nil, newSyntaxError(itr, ch, "unknown opening character %s", describeByte(lastOpen))
 		}
-
-		prev = ch
 	}
 }
 
@@ -201,14 +386,20 @@ var emptyListBytes = []byte{}
 
 // ParseVal parses a json value
 func ParseVal(itr *BufferedByteStreamIter, addFn ListAddFunc, parentType ParentType) (bool, []byte, error) {
+	return (&Parser{}).ParseVal(itr, addFn, parentType)
+}
+
+// ParseVal parses a json value. Lists found when parentType is None are parsed with ParseList, calling addFn for each
+// item, otherwise they are returned as a single value.
+func (p *Parser) ParseVal(itr *BufferedByteStreamIter, addFn ListAddFunc, parentType ParentType) (bool, []byte, error) {
 	SkipWhitespace(itr)
 	ch := itr.Next()
 	switch ch {
 	case 0:
-		return false, nil, errors.New("Reached EOF while parsing value")
+		return false, nil, newSyntaxError(itr, ch, "unexpected EOF found while parsing value")
 
 	case QM:
-		val, err := ParseUntil(itr, QM)
+		val, err := p.parseString(itr)
 		return false, val, err
 
 	case OpenSB:
@@ -216,16 +407,16 @@ func ParseVal(itr *BufferedByteStreamIter, addFn ListAddFunc, parentType ParentT
 		itr.Skip()
 
 		if parentType == None {
-			return true, nil, ParseList(itr, addFn)
+			return true, nil, p.ParseList(itr, addFn)
 		} else {
-			listObj, err := ParseObject(itr)
+			listObj, err := p.ParseObject(itr)
 			return true, listObj, err
 		}
 
 	case OpenCB:
 		itr.Advance(-1)
 		itr.Skip()
-		val, err := ParseObject(itr)
+		val, err := p.ParseObject(itr)
 		return false, val, err
 
 	default:
@@ -233,117 +424,348 @@ func ParseVal(itr *BufferedByteStreamIter, addFn ListAddFunc, parentType ParentT
 			itr.Advance(-1)
 			return true, nil, nil
 		} else {
+			if p.Strict {
+				p.v.reset()
+				if msg := p.v.step(ch); len(msg) != 0 {
+					return false, nil, newSyntaxError(itr, ch, "%s", msg)
+				}
+			}
+
 			for {
 				ch = itr.Next()
 				if ch == COMMA || ch == CloseSB || ch == CloseCB {
+					if p.Strict {
+						if msg := p.v.end(); len(msg) != 0 {
+							return false, nil, newSyntaxError(itr, ch, "%s", msg)
+						}
+					}
+
+					// whitespace between the value and the delimiter isn't part of the value, and a line break would
+					// split the item across lines of a jsonl file
 					itr.Advance(-1)
-					return false, itr.Value(), nil
+					return false, bytes.TrimRight(itr.Value(), " \t\r\n"), nil
 				} else if ch == 0 {
-					return false, nil, errors.New("reached EOF while parsing value")
+					return false, nil, newSyntaxError(itr, ch, "unexpected EOF found while parsing value")
+				} else if p.Strict {
+					if msg := p.v.step(ch); len(msg) != 0 {
+						return false, nil, newSyntaxError(itr, ch, "%s", msg)
+					}
 				}
 			}
 		}
 	}
 }
 
-// ParseList parses a json list calling addFn for each list item
+// ParseList parses a json list calling addFn for each list item.  The iterator is released after each item is added, so
+// slices previously returned by itr must not be used once ParseList has been called.
 func ParseList(itr *BufferedByteStreamIter, addFn func(item []byte) error) error {
+	return (&Parser{}).ParseList(itr, addFn)
+}
+
+// ParseList parses a json list calling addFn for each list item.  The iterator is released after each item is added, so
+// slices previously returned by itr must not be used once ParseList has been called.
+func (p *Parser) ParseList(itr *BufferedByteStreamIter, addFn func(item []byte) error) error {
 	SkipWhitespace(itr)
 	ch := itr.Next()
 	if ch != OpenSB {
-		return fmt.Errorf("unexpected char '%v' found while looking for '['", string(ch))
+		return newSyntaxError(itr, ch, "unexpected %s found while looking for '['", describeByte(ch))
 	}
 
 	itr.Skip()
-	for {
-		_, newVal, err := ParseVal(itr, nil, List)
+	for idx := 0; ; idx++ {
+		_, newVal, err := p.ParseVal(itr, nil, List)
 		if err != nil {
-			return err
+			return withPathSegment(err, strconv.Itoa(idx))
 		}
 
 		if newVal != nil {
 			err = addFn(newVal)
 			if err != nil {
-				return err
+				return withPathSegment(err, strconv.Itoa(idx))
 			}
+
+			itr.Release()
+		} else if p.Strict && idx > 0 {
+			return newSyntaxError(itr, 0, "trailing comma found at the end of list")
 		}
 
 		SkipWhitespace(itr)
 		ch = itr.Next()
-		itr.Skip()
-
 		if ch == CloseSB {
+			itr.Skip()
 			return nil
 		} else if ch != COMMA {
-			return fmt.Errorf("unexpected token '%v' found. Expecting ','", rune(ch))
+			return newSyntaxError(itr, ch, "unexpected %s found. Expecting ',' or ']'", describeByte(ch))
 		}
+
+		itr.Skip()
 	}
 }
 
 // SplitStream processes a json byte stream reading it and sending json lists in the root of the json document to jsonl
-// files sharded based on the size of the data written. Non-List root level objects are written to a file named root.json
+// files sharded based on the size of the data written. Non-List root level objects are written to a file named root.json.
+// If the root of the document is a list its items are written to jsonl files named items_%02d.jsonl
 func SplitStream(ctx context.Context, rd ByteStream, dir string) error {
-	itr := NewBufferedStreamIter(rd, ctx)
+	opts := SplitterOptions{OutputDir: dir}
+	opts.setDefaults()
+	return splitStream(ctx, rd, opts)
+}
 
-	SkipWhitespace(itr)
-	ch := itr.Next()
-	if ch != '{' {
-		fmt.Errorf("Invalid format. Only json objects are supported")
+// streamSplitter holds the state used while splitting a single stream
+type streamSplitter struct {
+	itr    *BufferedByteStreamIter
+	opts   SplitterOptions
+	parser *Parser
+	// pool writes the items of each list asynchronously. It is nil when items are written by the parsing goroutine
+	pool *WriterPool
+}
+
+func splitStream(ctx context.Context, rd ByteStream, opts SplitterOptions) error {
+	paths, err := newPathTree(opts.Paths)
+	if err != nil {
+		return err
+	}
+
+	ss := &streamSplitter{
+		itr:    NewBufferedStreamIter(rd, ctx),
+		opts:   opts,
+		parser: &Parser{Strict: opts.Strict, ControlChars: opts.ControlChars},
+	}
+
+	if opts.WriterGoroutines > 0 {
+		ss.pool = NewWriterPool(opts.WriterGoroutines)
+		defer ss.pool.Close()
 	}
-	itr.Skip()
 
 	start := time.Now()
-	rootItems := make([]byte, 0, 128*1024)
-	rootItems = append(rootItems, []byte("{\n")...)
-	initialLen := len(rootItems)
+
+	itr := ss.itr
+	switch PeekNext(itr) {
+	case OpenCB:
+		err = ss.splitRootObject(paths)
+	case OpenSB:
+		_, err = ss.splitVal(opts.RootListName)
+	default:
+		ch := itr.Next()
+		err = newSyntaxError(itr, ch, "invalid format. Only json objects and lists are supported, found %s", describeByte(ch))
+	}
+
+	// a stream which fails reads as if it ended early, so a read error is returned in place of the syntax error it causes
+	if itr.Err() != nil {
+		return itr.Err()
+	} else if err != nil {
+		return err
+	}
+
+	if opts.Strict {
+		SkipWhitespace(itr)
+		if ch := itr.Next(); itr.Err() != nil {
+			return itr.Err()
+		} else if ch != 0 || !itr.eof {
+			return newSyntaxError(itr, ch, "unexpected %s found after the end of the document", describeByte(ch))
+		}
+	}
+
+	opts.Logger.Info("Completed", "seconds", time.Since(start).Seconds())
+	return nil
+}
+
+// splitRootObject splits a document whose root is an object, writing the entries which are not extracted to root.json
+func (ss *streamSplitter) splitRootObject(paths *pathNode) error {
+	ss.itr.Next()
+	ss.itr.Skip()
+
+	root := newRootFile()
+	err := ss.splitObject(paths, root.add)
+	if err != nil {
+		return err
+	}
+
+	return root.write(ss.opts.OutputDir, ss.opts.Logger)
+}
+
+// rootFile accumulates the entries of the root object which are written to root.json
+type rootFile struct {
+	data []byte
+}
+
+func newRootFile() *rootFile {
+	data := make([]byte, 0, 128*1024)
+	return &rootFile{data: append(data, OpenCB, LF)}
+}
+
+func (rf *rootFile) add(key, val []byte) {
+	if len(rf.data) > 2 {
+		rf.data = append(rf.data, COMMA, LF)
+	}
+
+	rf.data = append(rf.data, '\t')
+	rf.data = append(rf.data, key...)
+	rf.data = append(rf.data, COLON)
+	rf.data = append(rf.data, val...)
+}
+
+// write closes the object and writes it to root.json in the output directory
+func (rf *rootFile) write(outputDir string, logger *slog.Logger) error {
+	if len(rf.data) > 2 {
+		rf.data = append(rf.data, LF)
+	}
+	rf.data = append(rf.data, CloseCB)
+
+	rootFile := filepath.Join(outputDir, "root.json")
+	err := os.WriteFile(rootFile, rf.data, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Wrote root values", "file", rootFile)
+	return nil
+}
+
+// splitObject parses the entries of an object whose opening brace has already been read. Lists found at the paths
+// within node are written to jsonl files, and objects which contain those paths are split recursively.  All remaining
+// entries are passed to addEntry.  A nil node extracts every list in the object.
+func (ss *streamSplitter) splitObject(node *pathNode, addEntry func(key, val []byte)) error {
+	itr := ss.itr
+	if PeekNext(itr) == CloseCB {
+		itr.Next()
+		itr.Skip()
+		return nil
+	}
+
 	for {
-		key, err := ParseKey(itr)
+		key, err := ss.parser.ParseKey(itr)
 		if err != nil {
 			return err
 		}
 
-		fileFactory := NewBufferedWriterFactory(dir, string(key[1:len(key)-1]), 256*1024)
-		wr := NewSplittingJsonlWriter(fileFactory.CreateWriter, 4*1024*1024*1024)
-		_, val, err := ParseVal(itr, wr.Add, None)
-		if err != nil {
-			return err
+		// the key is copied as it is used after the value, and the iterator is released while lists are split
+		key = append([]byte(nil), key...)
+
+		var val []byte
+		child := node.child(keyName(key))
+		switch {
+		case node == nil:
+			val, err = ss.splitVal(string(key[1 : len(key)-1]))
+
+		case child == nil:
+			val, err = ss.parseUnsplitVal()
+
+		case len(child.outputName) != 0:
+			if PeekNext(itr) == OpenSB {
+				val, err = ss.splitVal(child.outputName)
+			} else {
+				val, err = ss.parseUnsplitVal()
+			}
+
+		case PeekNext(itr) == OpenCB:
+			itr.Next()
+			itr.Skip()
+
+			nested := []byte{OpenCB}
+			err = ss.splitObject(child, func(key, val []byte) {
+				if len(nested) > 1 {
+					nested = append(nested, COMMA)
+				}
+
+				nested = append(nested, key...)
+				nested = append(nested, COLON)
+				nested = append(nested, val...)
+			})
+			val = append(nested, CloseCB)
+
+		default:
+			val, err = ss.parseUnsplitVal()
 		}
 
-		err = wr.Close()
 		if err != nil {
-			return err
+			return withPathSegment(err, keyName(key))
 		}
 
 		if val != nil {
-			if len(rootItems) != initialLen {
-				rootItems = append(rootItems, []byte(",\n")...)
-			}
-
-			rootItems = append(rootItems, '\t')
-			rootItems = append(rootItems, key...)
-			rootItems = append(rootItems, ':')
-			rootItems = append(rootItems, val...)
+			addEntry(key, val)
 		}
 
 		SkipWhitespace(itr)
 		ch := itr.Next()
-		if ch == COMMA {
+		if ch == CloseCB {
 			itr.Skip()
-		} else if ch == CloseCB {
-			break
+			return nil
+		} else if ch != COMMA {
+			return newSyntaxError(itr, ch, "unexpected %s found. Expecting ',' or '}'", describeByte(ch))
 		}
+
+		itr.Skip()
 	}
+}
 
-	rootItems = append(rootItems, []byte("\n}")...)
-	rootFile := filepath.Join(dir, "root.json")
-	err := os.WriteFile(rootFile, rootItems, os.ModePerm)
+// splitVal parses a value.  If the value is a list its items are written to jsonl files with the supplied name,
+// otherwise the value is returned.
+func (ss *streamSplitter) splitVal(name string) ([]byte, error) {
+	addFn, closeFn := newListWriter(ss.opts, ss.pool, name)
+	_, val, err := ss.parser.ParseVal(ss.itr, addFn, None)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	fmt.Printf("%s written successfully\n", rootFile)
+	return val, closeFn()
+}
 
-	elapsed := time.Since(start)
-	fmt.Printf("Completed in %f seconds", elapsed.Seconds())
-	return nil
+// newListWriter returns functions for adding the items of a list to jsonl files with the supplied name, and for
+// closing the files once all the items have been added.  Items are written asynchronously by pool if it isn't nil.
+func newListWriter(opts SplitterOptions, pool *WriterPool, name string) (ListAddFunc, func() error) {
+	fileFactory := NewBufferedWriterFactoryWithCompression(opts.OutputDir, name, opts.WriteBufferSize, opts.OutputCompression)
+	fileFactory.progress = opts.progress
+	fileFactory.logger = opts.Logger
+	wr := NewSplittingJsonlWriterWithThreshold(fileFactory.CreateWriter, opts.splitThreshold())
+
+	addFn, closeFn := wr.Add, wr.Close
+	if pool != nil {
+		aw := NewAsyncJsonlWriter(pool, wr, opts.WriterQueueSize)
+		addFn, closeFn = aw.Add, aw.Close
+	}
+
+	if opts.InvalidUTF8 != InvalidUTF8Ignore {
+		checker := &utf8Checker{mode: opts.InvalidUTF8, list: name, add: addFn}
+		if checker.mode == InvalidUTF8Reject {
+			rejectsFactory := NewBufferedWriterFactoryWithCompression(opts.OutputDir, name+"_rejects", opts.WriteBufferSize, opts.OutputCompression)
+			rejectsFactory.progress = opts.progress
+			rejectsFactory.logger = opts.Logger
+			checker.rejects = NewSplittingJsonlWriterWithThreshold(rejectsFactory.CreateWriter, opts.splitThreshold())
+		}
+
+		listCloseFn := closeFn
+		addFn, closeFn = checker.Add, func() error {
+			err := checker.Close()
+			if err != nil {
+				return err
+			}
+
+			return listCloseFn()
+		}
+	}
+
+	return opts.progress.countItems(name, addFn), closeFn
+}
+
+// parseUnsplitVal parses a value without splitting it, returning lists as a single value
+func (ss *streamSplitter) parseUnsplitVal() ([]byte, error) {
+	_, val, err := ss.parser.ParseVal(ss.itr, nil, List)
+	return val, err
+}
+
+// keyName returns the name of a key parsed by ParseKey with the quotes removed and any escape sequences decoded
+func keyName(key []byte) string {
+	name := key[1 : len(key)-1]
+	if bytes.IndexByte(name, Escape) == -1 {
+		return string(name)
+	}
+
+	var decoded string
+	err := json.Unmarshal(key, &decoded)
+	if err != nil {
+		return string(name)
+	}
+
+	return decoded
 }
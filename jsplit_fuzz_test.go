@@ -0,0 +1,297 @@
+package jsplit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fuzzSeedDocs are tricky documents used to seed each of the differential fuzz targets
+var fuzzSeedDocs = []string{
+	`{}`,
+	`[]`,
+	` { "a" : [ 1 , 2 ] } `,
+	`{"list": [1, "two", {"three": 3}, [4], null, true, false, -5.5e-5]}`,
+	`{"esc": "\"\\\/\b\f\n\r\t\u00e9\ud83d\ude00", "list": ["\\", "\\\"", "C:\\temp\\", "}]\"[{"]}`,
+	`{"C:\\temp\\": ["\\\\"], "k\"ey": {"in\\": "\\"}}`,
+	`{"unicode é": ["日本", "😀"], "empty": "", "emptyList": [], "emptyObj": {}}`,
+	`[{"a": [[[[[[[[[[[[[[[[[[[[1]]]]]]]]]]]]]]]]]]]]}, {"b": {"c": {"d": {"e": {"f": {}}}}}}]`,
+	`{"nested": {"list": [1, 2]}, "list": [{"nested": [{"list": []}]}]}`,
+	`{"num": 0, "list": [1e400, 12345678901234567890, -0, 0.0000001]}`,
+	`{"dup": 1, "dup": 2, "dupList": [1], "dupList": [2]}`,
+	"{\"ws\":\t[\r\n 1 ,\r\n 2 ]\n}\n",
+	`["a", "b"] `,
+	`{"a": [1,]}`,
+	`{"a": 1,}`,
+	`{"a": [01]}`,
+	`{"a": tru}`,
+	`{"a": "\x"}`,
+	`{"a": 1} {}`,
+	`"root string"`,
+	`{"a": [1, 2] "b": [3, 4]}`,
+	`{"a": [1, 2]] "b": [3]}`,
+	`{"a": "x" "y", "b": [1]}`,
+	`{"a": [1 ", 2], "b": {"c": ]}, "d": ,}`,
+	`{"../escaped": [1], "sub/dir": [2], "sub%2Fdir": [3], "..": [4], "\\": [5], "\u0000": [6]}`,
+}
+
+func addFuzzSeeds(f *testing.F) {
+	for _, doc := range fuzzSeedDocs {
+		for _, readSize := range []uint8{0, 1, 2, 6} {
+			f.Add(doc, readSize)
+		}
+	}
+}
+
+// newFuzzItr returns an iterator over doc which reads it in chunks of between 1 and 64 bytes so that values straddle
+// chunk boundaries at every possible position
+func newFuzzItr(doc string, readSize uint8) *BufferedByteStreamIter {
+	return NewBufferedStreamIter(NewTestByteStream([]byte(doc), int(readSize%64)+1), context.Background())
+}
+
+// decodeJSON decodes data keeping numbers as json.Number so values are compared exactly as they were written
+func decodeJSON(t *testing.T, data []byte) interface{} {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	require.NoError(t, dec.Decode(&v), "%q", data)
+	return v
+}
+
+// firstByte returns the first non-whitespace byte of doc or 0 if it is all whitespace
+func firstByte(doc string) byte {
+	trimmed := strings.TrimLeft(doc, " \t\r\n")
+	if len(trimmed) == 0 {
+		return 0
+	}
+
+	return trimmed[0]
+}
+
+func FuzzParseObject(f *testing.F) {
+	addFuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, doc string, readSize uint8) {
+		if ch := firstByte(doc); !json.Valid([]byte(doc)) || (ch != OpenCB && ch != OpenSB) {
+			return
+		}
+
+		expected := decodeJSON(t, []byte(doc))
+		for _, p := range []*Parser{{}, {Strict: true}} {
+			res, err := p.ParseObject(newFuzzItr(doc, readSize))
+			require.NoError(t, err)
+			require.True(t, json.Valid(res), "%q", res)
+			require.Equal(t, expected, decodeJSON(t, res))
+		}
+	})
+}
+
+func FuzzParseVal(f *testing.F) {
+	addFuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, doc string, readSize uint8) {
+		if !json.Valid([]byte(doc)) {
+			return
+		}
+
+		// values within a list or object are terminated by the following comma or closing bracket
+		expected := decodeJSON(t, []byte(doc))
+		for _, p := range []*Parser{{}, {Strict: true}} {
+			_, res, err := p.ParseVal(newFuzzItr(doc+",", readSize), nil, List)
+			require.NoError(t, err)
+			require.True(t, json.Valid(res), "%q", res)
+			require.Equal(t, expected, decodeJSON(t, res))
+		}
+	})
+}
+
+func FuzzParseList(f *testing.F) {
+	addFuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, doc string, readSize uint8) {
+		if !json.Valid([]byte(doc)) || firstByte(doc) != OpenSB {
+			return
+		}
+
+		expected := decodeJSON(t, []byte(doc))
+		for _, p := range []*Parser{{}, {Strict: true}} {
+			items := []interface{}{}
+			err := p.ParseList(newFuzzItr(doc, readSize), func(item []byte) error {
+				require.True(t, json.Valid(item), "%q", item)
+				items = append(items, decodeJSON(t, item))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, expected, items)
+		}
+	})
+}
+
+// expectedSplit decodes doc returning the entries expected in root.json and the items expected in the jsonl files of
+// each list, keyed by the decoded name of the list.  Empty lists are dropped from the output entirely.  ok is false for
+// documents which can't be compared because a key is repeated or too long to be used in a file name.
+func expectedSplit(t *testing.T, doc string) (root map[string]interface{}, lists map[string][]interface{}, ok bool) {
+	lists = make(map[string][]interface{})
+	addList := func(name string, raw []byte) {
+		items := decodeJSON(t, raw).([]interface{})
+		if len(items) > 0 {
+			lists[name] = items
+		}
+	}
+
+	if firstByte(doc) == OpenSB {
+		addList(DefaultRootListName, []byte(doc))
+		return nil, lists, true
+	}
+
+	dec := json.NewDecoder(strings.NewReader(doc))
+	_, err := dec.Token()
+	require.NoError(t, err)
+
+	root = make(map[string]interface{})
+	seen := make(map[string]bool)
+	for dec.More() {
+		tok, err := dec.Token()
+		require.NoError(t, err)
+
+		key := tok.(string)
+		if seen[key] {
+			return nil, nil, false
+		}
+		seen[key] = true
+
+		var raw json.RawMessage
+		require.NoError(t, dec.Decode(&raw))
+
+		if raw[0] != OpenSB {
+			root[key] = decodeJSON(t, raw)
+		} else if len(key) > 32 {
+			return nil, nil, false
+		} else {
+			addList(key, raw)
+		}
+	}
+
+	return root, lists, true
+}
+
+// readSplit reads the output of splitting a document returning the decoded entries of root.json, or nil if it was
+// not written, and the decoded items of each list
+func readSplit(t *testing.T, dir string) (root map[string]interface{}, lists map[string][]interface{}) {
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	// sort the files so that the items of each list are read in order
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	lists = make(map[string][]interface{})
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		require.NoError(t, err)
+
+		if file.Name() == "root.json" {
+			require.True(t, json.Valid(data), "%q", data)
+			root = decodeJSON(t, data).(map[string]interface{})
+			continue
+		}
+
+		// files are named [key]_%02d.jsonl where key is the key as it was written in the document, with any bytes which
+		// can't be used in a file name percent encoded
+		base := strings.TrimSuffix(file.Name(), ".jsonl")
+		idx := strings.LastIndexByte(base, '_')
+		_, err = strconv.Atoi(base[idx+1:])
+		require.NoError(t, err, file.Name())
+
+		key, err := url.PathUnescape(base[:idx])
+		require.NoError(t, err, file.Name())
+
+		var name string
+		require.NoError(t, json.Unmarshal([]byte(`"`+key+`"`), &name))
+
+		for _, line := range strings.Split(string(data), "\n") {
+			require.True(t, json.Valid([]byte(line)), "%q", line)
+			lists[name] = append(lists[name], decodeJSON(t, []byte(line)))
+		}
+	}
+
+	return root, lists
+}
+
+func FuzzSplitStream(f *testing.F) {
+	addFuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, doc string, readSize uint8) {
+		ch := firstByte(doc)
+		valid := json.Valid([]byte(doc)) && (ch == OpenCB || ch == OpenSB)
+
+		strictDir := t.TempDir()
+		opts := SplitterOptions{OutputDir: strictDir, Strict: true}
+		opts.setDefaults()
+
+		err := splitStream(context.Background(), newFuzzItr(doc, readSize).stream, opts)
+		if !valid {
+			require.Error(t, err)
+			return
+		}
+
+		expectedRoot, expectedLists, ok := expectedSplit(t, doc)
+		if !ok {
+			return
+		}
+
+		require.NoError(t, err)
+
+		lenientDir := t.TempDir()
+		err = SplitStream(context.Background(), newFuzzItr(doc, readSize).stream, lenientDir)
+		require.NoError(t, err)
+
+		for _, dir := range []string{strictDir, lenientDir} {
+			root, lists := readSplit(t, dir)
+			require.Equal(t, expectedRoot, root)
+			require.Equal(t, expectedLists, lists)
+		}
+	})
+}
+
+// FuzzSplitParallel checks that splitting in parallel writes the same files as splitting sequentially, and fails for
+// the same documents
+func FuzzSplitParallel(f *testing.F) {
+	addFuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, doc string, chunkSize uint8) {
+		opts := SplitterOptions{MaxItemsPerFile: 3, ReadBufferSize: 7}
+		expected, expectedErr := splitToMap(t, doc, opts)
+
+		opts.Parallelism = 2
+		opts.ParallelChunkSize = int(chunkSize%16) + 1
+		actual, err := splitToMap(t, doc, opts)
+		requireSameSplit(t, expected, expectedErr, actual, err, "%q", doc)
+	})
+}
+
+func FuzzStructuralIndex(f *testing.F) {
+	addFuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, doc string, readSize uint8) {
+		// the index only engages once 64 bytes are buffered, so the document is repeated within a list and read in
+		// chunks which can hold whole blocks
+		list := []byte("[" + strings.Repeat(doc+",", 4) + doc + "]")
+		for _, mode := range []ControlCharMode{ControlCharEscape, ControlCharPreserve, ControlCharReject} {
+			expected := parseWith(&Parser{ControlChars: mode, noIndex: true}, list, int(readSize)+1)
+			actual := parseWith(&Parser{ControlChars: mode}, list, int(readSize)+1)
+			require.Equal(t, expected, actual)
+		}
+	})
+}
@@ -1,11 +1,21 @@
-package main
+package jsplit
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/dolthub/jsplit/internal/docgen"
 	"github.com/stretchr/testify/require"
 )
 
@@ -76,6 +86,13 @@ func TestParseUntil(t *testing.T) {
 
 	ch := itr.Next()
 	require.Equal(t, byte(':'), ch)
+
+	for _, str := range []string{`C:\\temp\\"`, `escaped \" quote"`, `\\\""`, `\\"`} {
+		itr = NewTestItr(str + `: "next"`)
+		key, err = ParseUntil(itr, QM)
+		require.NoError(t, err)
+		require.Equal(t, str, string(key))
+	}
 }
 
 func TestParseKey(t *testing.T) {
@@ -86,6 +103,11 @@ func TestParseKey(t *testing.T) {
 
 	ch := itr.Next()
 	require.Equal(t, byte(' '), ch)
+
+	itr = NewTestItr(`"C:\\temp\\": "value"`)
+	key, err = ParseKey(itr)
+	require.NoError(t, err)
+	require.Equal(t, []byte(`"C:\\temp\\"`), key)
 }
 
 func TestParseObject(t *testing.T) {
@@ -114,6 +136,10 @@ func TestParseObject(t *testing.T) {
 			name:   "list value",
 			objStr: `{"key":["string",0,true]}`,
 		},
+		{
+			name:   "escaped backslash before closing quote",
+			objStr: `{"path":"C:\\temp\\","next":["\\",{"k\\":"\\\"}"}]}`,
+		},
 		{
 			name: "object value with whitespace",
 			objStr: `{
@@ -163,6 +189,73 @@ func TestParseObject(t *testing.T) {
 	}
 }
 
+func TestParsersAreIndependent(t *testing.T) {
+	p1 := &Parser{}
+	p2 := &Parser{}
+
+	itr1 := NewTestItr(`{"a": [1, 2]} {"b": "one"}`)
+	itr2 := NewTestItr(`["x", {"y": null}]`)
+
+	res1, err := p1.ParseObject(itr1)
+	require.NoError(t, err)
+	res2, err := p2.ParseObject(itr2)
+	require.NoError(t, err)
+
+	require.Equal(t, `{"a":[1,2]}`, string(res1))
+	require.Equal(t, `["x",{"y":null}]`, string(res2))
+
+	// the result is only overwritten by another call on the same parser
+	res1, err = p1.ParseObject(itr1)
+	require.NoError(t, err)
+	require.Equal(t, `{"b":"one"}`, string(res1))
+	require.Equal(t, `["x",{"y":null}]`, string(res2))
+}
+
+func TestConcurrentSplitStream(t *testing.T) {
+	const docs = 8
+
+	dirs := make([]string, docs)
+	errs := make([]error, docs)
+	var wg sync.WaitGroup
+	for i := 0; i < docs; i++ {
+		dirs[i] = t.TempDir()
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			var sb strings.Builder
+			sb.WriteString(`{"doc": ` + strconv.Itoa(i) + `, "items": [`)
+			for j := 0; j < 1000; j++ {
+				if j > 0 {
+					sb.WriteByte(',')
+				}
+
+				fmt.Fprintf(&sb, `{"doc": %d, "item": %d, "nested": {"list": [%d, "%d"]}}`, i, j, j, i)
+			}
+			sb.WriteString(`]}`)
+
+			errs[i] = SplitStream(context.Background(), NewTestByteStream([]byte(sb.String()), 61), dirs[i])
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i := 0; i < docs; i++ {
+		require.NoError(t, errs[i])
+		requireContents(t, filepath.Join(dirs[i], "root.json"), fmt.Sprintf("{\n\t\"doc\":%d\n}", i))
+
+		data, err := os.ReadFile(filepath.Join(dirs[i], "items_00.jsonl"))
+		require.NoError(t, err)
+
+		lines := strings.Split(string(data), "\n")
+		require.Len(t, lines, 1000)
+		for j, line := range lines {
+			require.Equal(t, fmt.Sprintf(`{"doc":%d,"item":%d,"nested":{"list":[%d,"%d"]}}`, i, j, j, i), line)
+		}
+	}
+}
+
 type ListWriteStream struct {
 	data []byte
 }
@@ -355,3 +448,354 @@ func requireContents(t *testing.T, filename string, expectedContents string) {
 		require.Equal(t, expectedContents, string(data))
 	})
 }
+
+func TestSplitStreamPaths(t *testing.T) {
+	const testStr = `{
+	"status": "ok",
+	"top_list": [1, 2, 3],
+	"response": {
+		"page": 1,
+		"items": [{"id": 1}, {"id": 2}],
+		"meta": {"records": ["a", "b"], "count": 2},
+		"not_a_list": {"items": []}
+	},
+	"data": {"records": "not a list"}
+}`
+
+	tempDir := t.TempDir()
+	opts := SplitterOptions{
+		OutputDir: tempDir,
+		Paths:     []string{"response.items", "/response/meta/records", "/data/records", "/missing/list"},
+	}
+	opts.setDefaults()
+
+	err := splitStream(context.Background(), NewTestByteStream([]byte(testStr), 16), opts)
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(tempDir, "root.json"), `{
+	"status":"ok",
+	"top_list":[1,2,3],
+	"response":{"page":1,"meta":{"count":2},"not_a_list":{"items":[]}},
+	"data":{"records":"not a list"}
+}`)
+	requireContents(t, filepath.Join(tempDir, "response.items_00.jsonl"), "{\"id\":1}\n{\"id\":2}")
+	requireContents(t, filepath.Join(tempDir, "response.meta.records_00.jsonl"), "\"a\"\n\"b\"")
+
+	// keys containing separators are written to files within the output directory
+	tempDir = t.TempDir()
+	opts = SplitterOptions{OutputDir: tempDir, Paths: []string{"/a~1b/..", "/../c"}}
+	opts.setDefaults()
+
+	err = splitStream(context.Background(), NewTestByteStream([]byte(`{"a/b": {"..": [1]}, "..": {"c": [2]}}`), 16), opts)
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(tempDir, "a%2Fb..._00.jsonl"), "1")
+	requireContents(t, filepath.Join(tempDir, "...c_00.jsonl"), "2")
+}
+
+func TestSplitStreamEmptyObject(t *testing.T) {
+	tempDir := t.TempDir()
+	err := SplitStream(context.Background(), NewTestByteStream([]byte(" { } "), 4), tempDir)
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(tempDir, "root.json"), "{\n}")
+}
+
+func TestSplitStreamRootList(t *testing.T) {
+	tempDir := t.TempDir()
+	err := SplitStream(context.Background(), NewTestByteStream([]byte(` [{"id": 1}, {"id": 2}, [3], "four"] `), 8), tempDir)
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(tempDir, "items_00.jsonl"), "{\"id\":1}\n{\"id\":2}\n[3]\n\"four\"")
+
+	_, err = os.Stat(filepath.Join(tempDir, "root.json"))
+	require.True(t, os.IsNotExist(err))
+
+	tempDir = t.TempDir()
+	opts := SplitterOptions{OutputDir: tempDir, RootListName: "records"}
+	opts.setDefaults()
+	err = splitStream(context.Background(), NewTestByteStream([]byte(`[1,2]`), 8), opts)
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(tempDir, "records_00.jsonl"), "1\n2")
+}
+
+func TestSplitStreamInvalidRoot(t *testing.T) {
+	for _, doc := range []string{``, `  `, `"string"`, `1234`} {
+		err := SplitStream(context.Background(), NewTestByteStream([]byte(doc), 8), t.TempDir())
+		require.Error(t, err)
+	}
+}
+
+func TestStrictParsing(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		msg  string
+		// lenientErr is true when the document is also rejected without strict parsing
+		lenientErr bool
+	}{
+		{"trailing comma in list", `{"list": [1, 2,]}`, "trailing comma found at the end of list", false},
+		{"trailing comma in item", `{"list": [{"a": 1,}]}`, `expected a string key found '}'`, false},
+		{"trailing comma in object", `{"a": 1,}`, `expected '"' found '}'`, true},
+		{"bare token", `{"a": abc}`, `unexpected 'a' found while looking for a value`, false},
+		{"bare token in list", `{"list": [1, abc]}`, `unexpected 'a' found while looking for a value`, false},
+		{"invalid number", `{"list": [01]}`, "invalid leading zero in number", false},
+		{"invalid literal", `{"a": tru}`, "incomplete json value", false},
+		{"invalid escape", `{"a": "\q"}`, `invalid escape sequence '\q' in string`, false},
+		{"invalid escape in key", `{"\q": 1}`, `invalid escape sequence '\q' in string`, false},
+		{"invalid escape in item", `{"list": [{"a": "\q"}]}`, `invalid escape sequence '\q' in string`, false},
+		{"raw newline in string", "{\"a\": \"line\nline\"}", `invalid control character '\n' in string`, false},
+		{"mismatched brackets", `{"list": [[1, 2}]}`, `mismatched '}' closing '['`, true},
+		{"escaped backslash before quote", `{"list": ["C:\\temp\\", "x"]}`, "", false},
+		{"content after document", `{"a": 1} {}`, `unexpected '{' found after the end of the document`, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lenientOpts := SplitterOptions{OutputDir: t.TempDir()}
+			lenientOpts.setDefaults()
+
+			err := splitStream(context.Background(), NewTestByteStream([]byte(test.doc), 4), lenientOpts)
+			if test.lenientErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			opts := SplitterOptions{OutputDir: t.TempDir(), Strict: true}
+			opts.setDefaults()
+
+			err = splitStream(context.Background(), NewTestByteStream([]byte(test.doc), 4), opts)
+			if len(test.msg) == 0 {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+
+			var se *SyntaxError
+			require.True(t, errors.As(err, &se), err.Error())
+			require.Equal(t, test.msg, se.Msg)
+		})
+	}
+}
+
+func TestStrictParsingValidDocument(t *testing.T) {
+	const doc = `{
+	"string": "val\"ue",
+	"number": -1.5e-3,
+	"literals": [true, false, null],
+	"object": {"key": [1, {"a": "b"}], "empty": {}},
+	"unicode": "\u00e9\ud83d\ude00"
+}`
+
+	lenientDir := t.TempDir()
+	err := SplitStream(context.Background(), NewTestByteStream([]byte(doc), 5), lenientDir)
+	require.NoError(t, err)
+
+	strictDir := t.TempDir()
+	opts := SplitterOptions{OutputDir: strictDir, Strict: true}
+	opts.setDefaults()
+	err = splitStream(context.Background(), NewTestByteStream([]byte(doc), 5), opts)
+	require.NoError(t, err)
+
+	for _, name := range []string{"root.json", "literals_00.jsonl"} {
+		expected, err := os.ReadFile(filepath.Join(lenientDir, name))
+		require.NoError(t, err)
+		requireContents(t, filepath.Join(strictDir, name), string(expected))
+	}
+}
+
+func TestSplitStreamEscapedBackslashes(t *testing.T) {
+	const doc = `{"dir": "C:\\temp\\", "files": [{"path": "C:\\temp\\"}, "D:\\", "\\\"}"], "last\\": 1}`
+
+	tempDir := t.TempDir()
+	err := SplitStream(context.Background(), NewTestByteStream([]byte(doc), 3), tempDir)
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(tempDir, "root.json"), "{\n\t\"dir\":\"C:\\\\temp\\\\\",\n\t\"last\\\\\":1\n}")
+	requireContents(t, filepath.Join(tempDir, "files_00.jsonl"), `{"path":"C:\\temp\\"}`+"\n"+`"D:\\"`+"\n"+`"\\\"}"`)
+}
+
+func TestSplitStreamUnusualKeys(t *testing.T) {
+	tempDir := t.TempDir()
+	err := SplitStream(context.Background(), NewTestByteStream([]byte(`{"100%d": [1, 2]}`), 4), tempDir)
+	require.NoError(t, err)
+
+	// % is percent encoded so that it can't be confused with the encoding of a path separator
+	requireContents(t, filepath.Join(tempDir, "100%25d_00.jsonl"), "1\n2")
+
+	tempDir = t.TempDir()
+	err = SplitStream(context.Background(), NewTestByteStream([]byte(`{"": [1, 2]}`), 4), tempDir)
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(tempDir, "_00.jsonl"), "1\n2")
+}
+
+func TestSplitUnsafeKeys(t *testing.T) {
+	const doc = `{"../escaped": [1], "sub/dir": [2], "sub%2Fdir": [3], "..": [4], "a\\b": [5]}`
+
+	for _, parallelism := range []int{1, 2} {
+		t.Run(fmt.Sprintf("parallelism %d", parallelism), func(t *testing.T) {
+			parent := t.TempDir()
+			filename := filepath.Join(parent, "doc.json")
+			require.NoError(t, os.WriteFile(filename, []byte(doc), 0644))
+
+			f, err := os.Open(filename)
+			require.NoError(t, err)
+			defer f.Close()
+
+			outputDir := filepath.Join(parent, "out")
+			require.NoError(t, os.Mkdir(outputDir, os.ModePerm))
+
+			s, err := NewSplitter(SplitterOptions{Reader: f, OutputDir: outputDir, Parallelism: parallelism, ParallelChunkSize: 8})
+			require.NoError(t, err)
+			require.NoError(t, s.Split(context.Background()))
+
+			entries, err := os.ReadDir(parent)
+			require.NoError(t, err)
+			require.Len(t, entries, 2)
+
+			requireContents(t, filepath.Join(outputDir, "..%2Fescaped_00.jsonl"), "1")
+			requireContents(t, filepath.Join(outputDir, "sub%2Fdir_00.jsonl"), "2")
+			requireContents(t, filepath.Join(outputDir, "sub%252Fdir_00.jsonl"), "3")
+			requireContents(t, filepath.Join(outputDir, ".._00.jsonl"), "4")
+			requireContents(t, filepath.Join(outputDir, "a%5C%5Cb_00.jsonl"), "5")
+		})
+	}
+}
+
+// FuzzSplitStreamStrings checks that strings containing any sequence of escapes survive splitting unchanged when used
+// as keys, values and list items
+func FuzzSplitStreamStrings(f *testing.F) {
+	for _, seed := range []string{"", "plain", `C:\temp\`, `\`, `\\`, `"`, `\"`, `"}]`, "line\r\nbreak", "tab\t", "é😀"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		encoded, err := json.Marshal(s)
+		require.NoError(t, err)
+
+		// invalid UTF-8 is replaced when marshalling so compare against the string which was actually encoded
+		require.NoError(t, json.Unmarshal(encoded, &s))
+
+		str := string(encoded)
+		doc := `{"str": ` + str + `, "list": [` + str + `, {"k": ` + str + `}, [` + str + `]], ` + str + `: {"obj": ` + str + `}}`
+
+		tempDir := t.TempDir()
+		err = SplitStream(context.Background(), NewTestByteStream([]byte(doc), 7), tempDir)
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(filepath.Join(tempDir, "list_00.jsonl"))
+		require.NoError(t, err)
+
+		lines := strings.Split(string(data), "\n")
+		require.Len(t, lines, 3)
+
+		var item string
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &item))
+		require.Equal(t, s, item)
+
+		var obj map[string]string
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), &obj))
+		require.Equal(t, map[string]string{"k": s}, obj)
+
+		var list []string
+		require.NoError(t, json.Unmarshal([]byte(lines[2]), &list))
+		require.Equal(t, []string{s}, list)
+
+		data, err = os.ReadFile(filepath.Join(tempDir, "root.json"))
+		require.NoError(t, err)
+
+		var root map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &root))
+		require.Equal(t, map[string]interface{}{"str": s, s: map[string]interface{}{"obj": s}}, root)
+	})
+}
+
+// benchmarkDocSize is the size of the documents generated for each shape by benchmarkDocs
+const benchmarkDocSize = 16 << 20
+
+var benchmarkDocsOnce sync.Once
+var benchmarkDocsByShape map[docgen.Shape][]byte
+
+// benchmarkDocs returns a generated document of each shape.  They are generated once and shared by the benchmarks.
+func benchmarkDocs() map[docgen.Shape][]byte {
+	benchmarkDocsOnce.Do(func() {
+		benchmarkDocsByShape = make(map[docgen.Shape][]byte)
+		for _, shape := range docgen.Shapes {
+			benchmarkDocsByShape[shape] = docgen.GenerateBytes(shape, benchmarkDocSize, 1, false)
+		}
+	})
+
+	return benchmarkDocsByShape
+}
+
+// runShapeBenchmarks runs fn as a sub-benchmark for the document of each shape, reporting throughput in bytes of the
+// document
+func runShapeBenchmarks(b *testing.B, fn func(b *testing.B, doc []byte)) {
+	docs := benchmarkDocs()
+	for _, shape := range docgen.Shapes {
+		doc := docs[shape]
+		b.Run(string(shape), func(b *testing.B) {
+			b.SetBytes(int64(len(doc)))
+			b.ReportAllocs()
+			fn(b, doc)
+		})
+	}
+}
+
+// discardLogs discards the messages logged by the default logger while splitting for the rest of the benchmark
+func discardLogs(b *testing.B) {
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	b.Cleanup(func() {
+		slog.SetDefault(logger)
+	})
+}
+
+func BenchmarkParseObject(b *testing.B) {
+	runShapeBenchmarks(b, func(b *testing.B, doc []byte) {
+		// the strict parser validates a byte at a time and never uses the structural index
+		parsers := []struct {
+			name string
+			p    Parser
+		}{
+			{"index", Parser{}},
+			{"byte scan", Parser{noIndex: true}},
+			{"strict", Parser{Strict: true}},
+		}
+
+		for _, parser := range parsers {
+			b.Run(parser.name, func(b *testing.B) {
+				b.SetBytes(int64(len(doc)))
+				b.ReportAllocs()
+				p := &parser.p
+				for i := 0; i < b.N; i++ {
+					_, err := p.ParseObject(NewBufferedStreamIter(NewTestByteStream(doc, DefaultReadBufferSize), context.Background()))
+					require.NoError(b, err)
+				}
+			})
+		}
+	})
+}
+
+func BenchmarkSplitStream(b *testing.B) {
+	discardLogs(b)
+	runShapeBenchmarks(b, func(b *testing.B, doc []byte) {
+		for i := 0; i < b.N; i++ {
+			dir := b.TempDir()
+			rd, err := AsyncReaderFromReader(bytes.NewReader(doc), DefaultReadBufferSize)
+			require.NoError(b, err)
+
+			ctx := rd.Start(context.Background())
+			require.NoError(b, SplitStream(ctx, rd, dir))
+
+			// removing the output isn't part of splitting
+			b.StopTimer()
+			require.NoError(b, os.RemoveAll(dir))
+			b.StartTimer()
+		}
+	})
+}
@@ -0,0 +1,809 @@
+package jsplit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultParallelChunkSize is the number of bytes of list items parsed by each job when splitting in parallel
+const DefaultParallelChunkSize = 4 * 1024 * 1024
+
+// chunk is a range of the input holding consecutive items of a list, without the surrounding brackets
+type chunk struct {
+	start, end int64
+	// firstIndex is the index within the list of the chunk's first item
+	firstIndex int
+}
+
+// rootEntry is an entry in the root of a document found while indexing.  The key range is empty for the list at the root
+// of a document.
+type rootEntry struct {
+	keyStart, keyEnd int64
+	// start and end are the range of the value.  The range of a value which is not a list may include trailing
+	// whitespace
+	start, end int64
+	isList     bool
+}
+
+// isStructural identifies the bytes which the indexer tracks inside objects and lists.  NUL bytes are tracked
+// everywhere as the parser reads them as the end of its input.
+var isStructural [256]bool
+
+// isScalarEnd identifies the bytes which end a value which is not a string, object or list
+var isScalarEnd [256]bool
+
+func init() {
+	for _, ch := range []byte{0, QM, OpenCB, CloseCB, OpenSB, CloseSB} {
+		isStructural[ch] = true
+	}
+
+	for _, ch := range []byte{0, COMMA, CloseCB, CloseSB} {
+		isScalarEnd[ch] = true
+	}
+}
+
+const (
+	indexStart = iota
+	indexKey
+	indexColon
+	indexValueStart
+	indexItemStart
+	indexValue
+	indexScalar
+	indexItemEnd
+	indexValueEnd
+	indexDone
+)
+
+// indexer scans a document for the entries in its root and divides the lists among them into chunks of roughly
+// chunkSize bytes, ending each chunk at the comma between two items.  It follows the structure of the document the way
+// the parser does, so that it accepts the same documents and finds the same items, but leaves the validation of the
+// values themselves to the parser.  Within an object or list a closing bracket which doesn't match the innermost
+// opening one is part of the value, as it is for ParseObject, while anything other than a comma or the closing bracket
+// following a value in the root object or in a list being split is an error.
+type indexer struct {
+	chunkSize int64
+	onChunk   func(entry *rootEntry, c chunk) error
+
+	rootList bool
+	entries  []*rootEntry
+	entry    *rootEntry
+
+	state    int
+	inString bool
+	escaped  bool
+	inKey    bool
+	// open holds the brackets which are open within the value being indexed
+	open ByteStack
+
+	// inList is true while the items of a list are being indexed
+	inList     bool
+	listIndex  int
+	chunkStart int64
+	chunkFirst int
+}
+
+// indexDocument scans the document held in the range [start, end) of ra, calling onChunk for each chunk of list items
+// in document order
+func indexDocument(ctx context.Context, ra io.ReaderAt, start, end int64, bufferSize int, chunkSize int64, onChunk func(entry *rootEntry, c chunk) error) (*indexer, error) {
+	ix := &indexer{chunkSize: chunkSize, onChunk: onChunk}
+	buf := make([]byte, bufferSize)
+	for pos := start; pos < end && ix.state != indexDone; {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		n := int64(len(buf))
+		if end-pos < n {
+			n = end - pos
+		}
+
+		read, err := ra.ReadAt(buf[:n], pos)
+		if int64(read) < n {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return nil, err
+		}
+
+		err = ix.scan(buf[:n], pos)
+		if err != nil {
+			return nil, ix.withPath(err, ra, bufferSize)
+		}
+
+		pos += n
+	}
+
+	switch ix.state {
+	case indexDone:
+		return ix, nil
+	case indexStart:
+		return nil, &SyntaxError{Msg: "invalid format. Only json objects and lists are supported, found EOF", Position: Position{Offset: end}}
+	default:
+		err := &SyntaxError{Msg: "unexpected EOF found while indexing the document", Position: Position{Offset: end}}
+		return nil, ix.withPath(err, ra, bufferSize)
+	}
+}
+
+// withPath adds the path of the value being indexed to a *SyntaxError, as the parser does when splitting sequentially.
+// The path holds the key of the root entry whose value contains the problem, followed by the index of the list item
+// when the problem is within an item rather than between items.
+func (ix *indexer) withPath(err error, ra io.ReaderAt, bufferSize int) error {
+	if ix.entry == nil {
+		return err
+	}
+
+	switch ix.state {
+	case indexItemStart, indexValue, indexScalar:
+		if ix.inList {
+			err = withPathSegment(err, strconv.Itoa(ix.listIndex))
+		}
+	case indexValueStart, indexItemEnd:
+	default:
+		return err
+	}
+
+	// the list at the root of a document has no key
+	if ix.entry.keyEnd == 0 {
+		return err
+	}
+
+	key, keyErr := parseKey(&Parser{}, ra, ix.entry, bufferSize)
+	if keyErr != nil {
+		return err
+	}
+
+	return withPathSegment(err, keyName(key))
+}
+
+// scan processes a block of the document which starts at offset base
+func (ix *indexer) scan(buf []byte, base int64) error {
+	for i := 0; i < len(buf); i++ {
+		if ix.inString {
+			i = ix.scanString(buf, i, base)
+			if buf[i] != 0 {
+				continue
+			}
+		}
+
+		switch ix.state {
+		case indexValue:
+			// skip the bytes of numbers, literals and whitespace in bulk
+			for i < len(buf) && !isStructural[buf[i]] {
+				i++
+			}
+
+		case indexScalar:
+			for i < len(buf) && !isScalarEnd[buf[i]] {
+				i++
+			}
+		}
+
+		if i == len(buf) {
+			break
+		}
+
+		ch := buf[i]
+		if isWhitespace[ch] {
+			continue
+		} else if ch == 0 && ix.state != indexDone {
+			// the parser fails at a NUL byte as if the input had ended, reporting the offset following it
+			se := ix.syntaxError(buf, i, base, "unexpected EOF found while indexing the document")
+			se.Offset++
+			return se
+		}
+
+		pos := base + int64(i)
+		switch ix.state {
+		case indexStart:
+			switch ch {
+			case OpenCB:
+				ix.state = indexKey
+			case OpenSB:
+				ix.rootList = true
+				ix.entry = &rootEntry{start: pos, isList: true}
+				ix.startList(pos)
+			default:
+				return ix.syntaxError(buf, i, base, "invalid format. Only json objects and lists are supported, found %s", describeByte(ch))
+			}
+
+		case indexKey:
+			if ch == CloseCB && len(ix.entries) == 0 {
+				ix.state = indexDone
+			} else if ch == QM {
+				ix.entry = &rootEntry{keyStart: pos}
+				ix.inString, ix.inKey = true, true
+				ix.state = indexColon
+			} else {
+				return ix.syntaxError(buf, i, base, "expected %s found %s", describeByte(QM), describeByte(ch))
+			}
+
+		case indexColon:
+			if ch != COLON {
+				return ix.syntaxError(buf, i, base, "expected %s found %s", describeByte(COLON), describeByte(ch))
+			}
+
+			ix.state = indexValueStart
+
+		case indexValueStart:
+			ix.entry.start = pos
+			if ch == OpenSB {
+				ix.entry.isList = true
+				ix.startList(pos)
+			} else {
+				ix.startValue(ch)
+			}
+
+		case indexItemStart:
+			if ch == CloseSB {
+				err := ix.endList(pos)
+				if err != nil {
+					return err
+				}
+			} else {
+				ix.startValue(ch)
+			}
+
+		case indexValue:
+			switch ch {
+			case QM:
+				ix.inString = true
+
+			case OpenCB, OpenSB:
+				ix.open.Push(ch)
+
+			case CloseCB, CloseSB:
+				// as in ParseObject, a bracket which doesn't close the innermost open one is part of the value
+				if closeFor(ix.open.Peek()) == ch {
+					ix.open.Pop()
+					if len(ix.open.chars) == 0 {
+						ix.endValue()
+					}
+				}
+			}
+
+		case indexScalar:
+			// the comma or bracket ending the value is processed again once the value has ended
+			ix.endValue()
+			i--
+
+		case indexItemEnd:
+			switch ch {
+			case COMMA:
+				ix.listIndex++
+				if pos-ix.chunkStart >= ix.chunkSize {
+					err := ix.endChunk(pos)
+					if err != nil {
+						return err
+					}
+
+					ix.chunkStart = pos + 1
+					ix.chunkFirst = ix.listIndex
+				}
+
+				ix.state = indexItemStart
+
+			case CloseSB:
+				err := ix.endList(pos)
+				if err != nil {
+					return err
+				}
+
+			default:
+				return ix.syntaxError(buf, i, base, "unexpected %s found. Expecting ',' or ']'", describeByte(ch))
+			}
+
+		case indexValueEnd:
+			switch ch {
+			case COMMA:
+				ix.endEntry(pos)
+				ix.state = indexKey
+
+			case CloseCB:
+				ix.endEntry(pos)
+				ix.state = indexDone
+
+			default:
+				return ix.syntaxError(buf, i, base, "unexpected %s found. Expecting ',' or '}'", describeByte(ch))
+			}
+
+		case indexDone:
+			// anything following the document is ignored as it is when splitting sequentially
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// scanString consumes string bytes starting at index i of buf, returning the index of the last byte consumed
+func (ix *indexer) scanString(buf []byte, i int, base int64) int {
+	if ix.escaped {
+		ix.escaped = false
+		return i
+	}
+
+	for ; i < len(buf); i++ {
+		if ch := buf[i]; ch == 0 {
+			return i
+		} else if ch == Escape {
+			ix.escaped = true
+			return i
+		} else if ch == QM {
+			ix.inString = false
+			if ix.inKey {
+				ix.inKey = false
+				ix.entry.keyEnd = base + int64(i) + 1
+			} else if len(ix.open.chars) == 0 {
+				ix.endValue()
+			}
+
+			return i
+		}
+	}
+
+	return len(buf) - 1
+}
+
+// startValue starts a value, other than a list being split, whose first byte is ch.  As in ParseVal, a value which
+// doesn't start with a quote or a bracket continues up to the next comma or closing bracket.
+func (ix *indexer) startValue(ch byte) {
+	switch ch {
+	case QM:
+		ix.inString = true
+		ix.state = indexValue
+	case OpenCB, OpenSB:
+		ix.open.Push(ch)
+		ix.state = indexValue
+	default:
+		ix.state = indexScalar
+	}
+}
+
+// endValue is called at the end of a value, after which a comma or the closing bracket of the list or object holding
+// it must follow
+func (ix *indexer) endValue() {
+	if ix.inList {
+		ix.state = indexItemEnd
+	} else {
+		ix.state = indexValueEnd
+	}
+}
+
+func (ix *indexer) startList(pos int64) {
+	ix.inList = true
+	ix.listIndex = 0
+	ix.chunkStart = pos + 1
+	ix.chunkFirst = 0
+	ix.state = indexItemStart
+}
+
+// endList ends the list being split at the closing bracket found at pos
+func (ix *indexer) endList(pos int64) error {
+	err := ix.endChunk(pos)
+	if err != nil {
+		return err
+	}
+
+	ix.entry.end = pos + 1
+	ix.inList = false
+	if ix.rootList {
+		ix.endEntry(pos)
+		ix.state = indexDone
+	} else {
+		ix.state = indexValueEnd
+	}
+
+	return nil
+}
+
+func (ix *indexer) endChunk(pos int64) error {
+	return ix.onChunk(ix.entry, chunk{start: ix.chunkStart, end: pos, firstIndex: ix.chunkFirst})
+}
+
+func (ix *indexer) endEntry(pos int64) {
+	if !ix.entry.isList {
+		ix.entry.end = pos
+	}
+
+	ix.entries = append(ix.entries, ix.entry)
+	ix.entry = nil
+}
+
+// closeFor returns the closing bracket for the opening bracket ch
+func closeFor(ch byte) byte {
+	if ch == OpenCB {
+		return CloseCB
+	}
+
+	return CloseSB
+}
+
+func (ix *indexer) syntaxError(buf []byte, i int, base int64, format string, args ...interface{}) *SyntaxError {
+	start, end := i-snippetRadius, i+snippetRadius
+	if start < 0 {
+		start = 0
+	}
+
+	if end > len(buf) {
+		end = len(buf)
+	}
+
+	return &SyntaxError{
+		Msg:      fmt.Sprintf(format, args...),
+		Position: Position{Offset: base + int64(i)},
+		Snippet:  append([]byte(nil), buf[start:end]...),
+	}
+}
+
+// sectionStream is a ByteStream which reads a range of an io.ReaderAt, surrounded by optional prefix and suffix bytes.
+// BufferedByteStreamIter panics on read errors, so they are recorded in err and the stream is ended early instead.
+type sectionStream struct {
+	ra         io.ReaderAt
+	pos, end   int64
+	bufferSize int
+	prefix     []byte
+	suffix     []byte
+	err        error
+}
+
+func (s *sectionStream) Read(_ context.Context) ([]byte, error) {
+	if len(s.prefix) != 0 {
+		prefix := s.prefix
+		s.prefix = nil
+		return prefix, nil
+	}
+
+	if s.pos < s.end && s.err == nil {
+		n := int64(s.bufferSize)
+		if s.end-s.pos < n {
+			n = s.end - s.pos
+		}
+
+		// the iterator holds on to the buffers it is given, so each read uses a new one
+		buf := make([]byte, n)
+		read, err := s.ra.ReadAt(buf, s.pos)
+		if int64(read) == n {
+			s.pos += n
+			return buf, nil
+		}
+
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+
+		s.err = err
+		return nil, io.EOF
+	}
+
+	if len(s.suffix) != 0 && s.err == nil {
+		suffix := s.suffix
+		s.suffix = nil
+		return suffix, nil
+	}
+
+	return nil, io.EOF
+}
+
+// parseSection calls parseFn with an iterator over the range [start, end) of ra surrounded by prefix and suffix.  The
+// position of a *SyntaxError returned by parseFn is changed to its offset in ra.  Lines are not counted when parsing a
+// section, so its Line and Column are 0 until they are set by positionInDocument.
+func parseSection(ra io.ReaderAt, start, end int64, prefix, suffix []byte, bufferSize int, parseFn func(itr *BufferedByteStreamIter) error) error {
+	stream := &sectionStream{ra: ra, pos: start, end: end, bufferSize: bufferSize, prefix: prefix, suffix: suffix}
+	err := parseFn(NewBufferedStreamIter(stream, context.Background()))
+	if stream.err != nil {
+		return stream.err
+	}
+
+	if se, ok := err.(*SyntaxError); ok {
+		se.Offset += start - int64(len(prefix))
+		se.Line, se.Column = 0, 0
+	}
+
+	return err
+}
+
+// chunkJob is a chunk of list items parsed by one of the workers
+type chunkJob struct {
+	entry *rootEntry
+	chunk chunk
+	items *itemBatch
+	err   error
+	done  chan struct{}
+}
+
+// splitParallel splits the document held in the range [start, end) of ra.  The document is indexed to find the chunks
+// of each list in its root, which are parsed by opts.Parallelism workers while indexing continues.  Parsed chunks are
+// written in document order, so the jsonl files are identical to those written when splitting sequentially.
+func splitParallel(ctx context.Context, ra io.ReaderAt, start, end int64, opts SplitterOptions) (err error) {
+	defer func() {
+		err = positionInDocument(err, ra, start, opts.ReadBufferSize)
+	}()
+
+	startTime := time.Now()
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	jobs := make(chan *chunkJob)
+	// pending holds the jobs in document order.  Its capacity bounds the number of parsed chunks waiting to be written
+	pending := make(chan *chunkJob, 2*opts.Parallelism)
+
+	var ix *indexer
+	var indexErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(pending)
+		defer close(jobs)
+
+		ix, indexErr = indexDocument(ctx, ra, start, end, opts.ReadBufferSize, int64(opts.ParallelChunkSize), func(entry *rootEntry, c chunk) error {
+			job := &chunkJob{entry: entry, chunk: c, done: make(chan struct{})}
+			for _, ch := range []chan *chunkJob{pending, jobs} {
+				select {
+				case ch <- job:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			return nil
+		})
+	}()
+
+	for i := 0; i < opts.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := &Parser{ControlChars: opts.ControlChars}
+			for job := range jobs {
+				job.items, job.err = parseChunk(p, ra, job.chunk, opts.ReadBufferSize)
+				close(job.done)
+			}
+		}()
+	}
+
+	var pool *WriterPool
+	if opts.WriterGoroutines > 0 {
+		pool = NewWriterPool(opts.WriterGoroutines)
+		defer pool.Close()
+	}
+
+	err = writeChunks(ctx, ra, start, pending, pool, opts)
+	if err != nil {
+		return err
+	}
+
+	// pending is closed once indexing finishes, so the results of the index are available
+	if indexErr != nil {
+		return indexErr
+	}
+
+	if !ix.rootList {
+		err = writeRootValues(ra, ix.entries, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts.progress.setRead(end - start)
+
+	opts.Logger.Info("Completed", "seconds", time.Since(startTime).Seconds())
+	return nil
+}
+
+// positionInDocument changes the position of a *SyntaxError found while splitting the document starting at offset
+// start of ra to its position in the document, as reported when splitting sequentially.  Lines are only counted once an
+// error has been found, so that splits which succeed don't pay for counting them.
+func positionInDocument(err error, ra io.ReaderAt, start int64, bufferSize int) error {
+	se, ok := err.(*SyntaxError)
+	if !ok {
+		return err
+	}
+
+	se.Offset -= start
+	line, lineStart := 1, int64(0)
+	buf := make([]byte, bufferSize)
+	for pos := int64(0); pos < se.Offset; {
+		n := min(int64(len(buf)), se.Offset-pos)
+		read, _ := ra.ReadAt(buf[:n], start+pos)
+		if int64(read) < n {
+			// the position is left without a line if the document can no longer be read
+			return se
+		}
+
+		if lf := bytes.LastIndexByte(buf[:n], LF); lf != -1 {
+			line += bytes.Count(buf[:n], newLineBytes)
+			lineStart = pos + int64(lf) + 1
+		}
+
+		pos += n
+	}
+
+	se.Line = line
+	se.Column = int(se.Offset-lineStart) + 1
+	return se
+}
+
+// parseChunk parses the items of a chunk, returning a batch holding a copy of each of them
+func parseChunk(p *Parser, ra io.ReaderAt, c chunk, bufferSize int) (*itemBatch, error) {
+	items := &itemBatch{}
+	err := parseSection(ra, c.start, c.end, []byte{OpenSB}, []byte{CloseSB}, bufferSize, func(itr *BufferedByteStreamIter) error {
+		err := p.ParseList(itr, func(item []byte) error {
+			items.data = append(items.data, item...)
+			items.ends = append(items.ends, len(items.data))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// the list must end at the closing bracket following the chunk, not at one found within it
+		return requireEnd(itr, 0)
+	})
+
+	// the list index added to the path of the error is relative to the start of the chunk
+	if se, ok := err.(*SyntaxError); ok && len(se.segments) != 0 {
+		last := len(se.segments) - 1
+		if idx, convErr := strconv.Atoi(se.segments[last]); convErr == nil {
+			se.segments[last] = strconv.Itoa(c.firstIndex + idx)
+			se.updatePath()
+		}
+	}
+
+	return items, err
+}
+
+// writeChunks writes the items of each job to the jsonl files of its list as the jobs are completed.  docStart is the
+// offset of the document within ra, from which progress is measured.
+func writeChunks(ctx context.Context, ra io.ReaderAt, docStart int64, pending <-chan *chunkJob, pool *WriterPool, opts SplitterOptions) error {
+	p := &Parser{ControlChars: opts.ControlChars}
+
+	var entry *rootEntry
+	var key []byte
+	var addFn ListAddFunc
+	var closeFn func() error
+
+	err := func() error {
+		for job := range pending {
+			select {
+			case <-job.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+			if job.entry != entry {
+				if closeFn != nil {
+					err := closeFn()
+					closeFn = nil
+					if err != nil {
+						return err
+					}
+				}
+
+				entry = job.entry
+				name := opts.RootListName
+				key = nil
+				if entry.keyEnd != 0 {
+					var err error
+					key, err = parseKey(p, ra, entry, opts.ReadBufferSize)
+					if err != nil {
+						return err
+					}
+
+					name = string(key[1 : len(key)-1])
+				}
+
+				addFn, closeFn = newListWriter(opts, pool, name)
+			}
+
+			err := job.err
+			start := 0
+			for _, end := range job.items.ends {
+				if err != nil {
+					break
+				}
+
+				err = addFn(job.items.data[start:end])
+				start = end
+			}
+
+			if err != nil {
+				if key != nil {
+					return withPathSegment(err, keyName(key))
+				}
+
+				return err
+			}
+
+			opts.progress.setRead(job.chunk.end - docStart)
+		}
+
+		if closeFn != nil {
+			err := closeFn()
+			closeFn = nil
+			if err != nil {
+				return err
+			}
+		}
+
+		return ctx.Err()
+	}()
+
+	if closeFn != nil {
+		// close the files of the list being written when the error occurred, the error is more useful than any error
+		// closing them
+		_ = closeFn()
+	}
+
+	return err
+}
+
+// writeRootValues writes the entries of the root object which are not lists to root.json
+func writeRootValues(ra io.ReaderAt, entries []*rootEntry, opts SplitterOptions) error {
+	p := &Parser{ControlChars: opts.ControlChars}
+	root := newRootFile()
+	for _, entry := range entries {
+		if entry.isList {
+			continue
+		}
+
+		key, err := parseKey(p, ra, entry, opts.ReadBufferSize)
+		if err != nil {
+			return err
+		}
+
+		var val []byte
+		err = parseSection(ra, entry.start, entry.end, nil, []byte{COMMA}, opts.ReadBufferSize, func(itr *BufferedByteStreamIter) error {
+			var err error
+			_, val, err = p.ParseVal(itr, nil, None)
+			if err != nil {
+				return err
+			}
+
+			// only whitespace may follow the value within its range, which is followed by the comma added as a suffix
+			return requireEnd(itr, COMMA)
+		})
+		if err != nil {
+			return withPathSegment(err, keyName(key))
+		}
+
+		root.add(key, val)
+	}
+
+	return root.write(opts.OutputDir, opts.Logger)
+}
+
+// requireEnd returns a *SyntaxError unless the next byte of itr other than whitespace is last.  A last of 0 requires the
+// end of the stream.
+func requireEnd(itr *BufferedByteStreamIter, last byte) error {
+	SkipWhitespace(itr)
+	if ch := itr.Next(); ch != last {
+		return newSyntaxError(itr, ch, "unexpected %s found after the end of the value", describeByte(ch))
+	}
+
+	return nil
+}
+
+// parseKey parses the key of an entry, returning a copy of it including its quotes
+func parseKey(p *Parser, ra io.ReaderAt, entry *rootEntry, bufferSize int) ([]byte, error) {
+	var key []byte
+	err := parseSection(ra, entry.keyStart, entry.keyEnd, nil, nil, bufferSize, func(itr *BufferedByteStreamIter) error {
+		itr.Next()
+		k, err := p.parseString(itr)
+		key = append([]byte(nil), k...)
+		return err
+	})
+
+	return key, err
+}
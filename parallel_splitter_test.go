@@ -0,0 +1,255 @@
+package jsplit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexDocument(t *testing.T) {
+	const doc = ` {"a": [1, "x,]", [2, 3], {"b": [4]}], "c": {"d": [5]}, "e": "f", "g": []} `
+
+	type indexedChunk struct {
+		key   string
+		items string
+		first int
+	}
+
+	var chunks []indexedChunk
+	ix, err := indexDocument(context.Background(), strings.NewReader(doc), 0, int64(len(doc)), 5, 1, func(entry *rootEntry, c chunk) error {
+		chunks = append(chunks, indexedChunk{
+			key:   doc[entry.keyStart:entry.keyEnd],
+			items: doc[c.start:c.end],
+			first: c.firstIndex,
+		})
+		return nil
+	})
+	require.NoError(t, err)
+	require.False(t, ix.rootList)
+
+	require.Equal(t, []indexedChunk{
+		{key: `"a"`, items: `1`, first: 0},
+		{key: `"a"`, items: ` "x,]"`, first: 1},
+		{key: `"a"`, items: ` [2, 3]`, first: 2},
+		{key: `"a"`, items: ` {"b": [4]}`, first: 3},
+		{key: `"g"`, items: ``, first: 0},
+	}, chunks)
+
+	var values []string
+	for _, entry := range ix.entries {
+		values = append(values, strings.TrimSpace(doc[entry.start:entry.end]))
+	}
+	require.Equal(t, []string{`[1, "x,]", [2, 3], {"b": [4]}]`, `{"d": [5]}`, `"f"`, `[]`}, values)
+}
+
+func TestIndexDocumentErrors(t *testing.T) {
+	tests := []struct {
+		doc    string
+		offset int64
+	}{
+		{doc: ``, offset: 0},
+		{doc: `  "root"`, offset: 2},
+		{doc: `{"a": 1, 2}`, offset: 9},
+		{doc: `{"a" 1}`, offset: 5},
+		{doc: `{"a": }`, offset: 7},
+		{doc: `{"a": [1, 2`, offset: 11},
+		{doc: `{"a": [1, 2] "b": [3, 4]}`, offset: 13},
+		{doc: `{"a": [1, 2]] "b": [3]}`, offset: 12},
+		{doc: `{"a": "x" "y", "b": [1]}`, offset: 10},
+		{doc: `{"a": {"b": 1} "c"}`, offset: 15},
+		{doc: `[[1] 2]`, offset: 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.doc, func(t *testing.T) {
+			_, err := indexDocument(context.Background(), strings.NewReader(test.doc), 0, int64(len(test.doc)), 3, 1, func(*rootEntry, chunk) error {
+				return nil
+			})
+
+			var se *SyntaxError
+			require.True(t, errors.As(err, &se), "%v", err)
+			require.Equal(t, test.offset, se.Offset)
+		})
+	}
+}
+
+// splitToMap splits doc with the supplied options and returns the contents of each file written
+func splitToMap(t *testing.T, doc string, opts SplitterOptions) (map[string]string, error) {
+	opts.Reader = strings.NewReader(doc)
+	opts.OutputDir = t.TempDir()
+	s, err := NewSplitter(opts)
+	require.NoError(t, err)
+
+	err = s.Split(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(opts.OutputDir)
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(opts.OutputDir, entry.Name()))
+		require.NoError(t, err)
+		files[entry.Name()] = string(data)
+	}
+
+	return files, nil
+}
+
+func TestSplitParallelMatchesSequential(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("\xef\xbb\xbf{\"name\": \"test\", ")
+	for _, key := range []string{"a", "b"} {
+		sb.WriteString(`"` + key + `": [`)
+		for i := 0; i < 3000; i++ {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(`{"key": "` + key + `", "s": "]},\"\\", "i": ` + strconv.Itoa(i) + `}`)
+		}
+		sb.WriteString(`], `)
+	}
+	sb.WriteString(`"nested": {"list": [1, 2]}}`)
+
+	docs := append([]string{sb.String()}, fuzzSeedDocs...)
+	for _, doc := range docs {
+		opts := SplitterOptions{MaxItemsPerFile: 700, ReadBufferSize: 13}
+		expected, expectedErr := splitToMap(t, doc, opts)
+
+		for _, chunkSize := range []int{1, 100, DefaultParallelChunkSize} {
+			opts.Parallelism = 3
+			opts.ParallelChunkSize = chunkSize
+			actual, err := splitToMap(t, doc, opts)
+			requireSameSplit(t, expected, expectedErr, actual, err, "%q chunk size %d", doc, chunkSize)
+		}
+	}
+}
+
+// requireSameSplit requires that a parallel split wrote the same files as a sequential split, or failed at the same
+// offset when the sequential split failed with a *SyntaxError
+func requireSameSplit(t *testing.T, expected map[string]string, expectedErr error, actual map[string]string, err error, msgAndArgs ...interface{}) {
+	if expectedErr == nil {
+		require.NoError(t, err, msgAndArgs...)
+		require.Equal(t, expected, actual, msgAndArgs...)
+		return
+	}
+
+	require.Error(t, err, msgAndArgs...)
+
+	var expectedSE, actualSE *SyntaxError
+	if errors.As(expectedErr, &expectedSE) {
+		require.True(t, errors.As(err, &actualSE), msgAndArgs...)
+		require.Equal(t, expectedSE.Position, actualSE.Position, "%v != %v", expectedErr, err)
+		require.Equal(t, expectedSE.Path, actualSE.Path, "%v != %v", expectedErr, err)
+	}
+}
+
+func TestSplitParallelErrors(t *testing.T) {
+	const doc = "{\"ok\": [\"a\"], \"list\": [\"a\", \"b\",\n\"c\", \"d\u0001\", \"e\"]}"
+
+	opts := SplitterOptions{ControlChars: ControlCharReject}
+	_, expectedErr := splitToMap(t, doc, opts)
+
+	opts.Parallelism = 2
+	opts.ParallelChunkSize = 1
+	_, err := splitToMap(t, doc, opts)
+
+	var expected, actual *SyntaxError
+	require.True(t, errors.As(expectedErr, &expected))
+	require.True(t, errors.As(err, &actual))
+	require.Equal(t, "/list/3", actual.Path)
+	require.Equal(t, expected.Path, actual.Path)
+	require.Equal(t, Position{Offset: 40, Line: 2, Column: 8}, actual.Position)
+	require.Equal(t, expected.Position, actual.Position)
+}
+
+func TestSplitParallelMalformedErrors(t *testing.T) {
+	docs := []struct {
+		doc  string
+		path string
+	}{
+		{`{"a":[1,2}`, "/a"},
+		{`{"a":[1,2`, "/a/1"},
+		{"{\"a\":[1],\n\"b\":[[1,2]}", "/b"},
+		{"{\"a\":[1],\n\"b\":[1,\x00]}", "/b/1"},
+		{`{"a":[{"x":1],2]}`, "/a"},
+		{`{"a\u002fb":[1}`, "/a~1b"},
+		{`{"a":[1],"b":"c`, "/b"},
+		{`{"a":[1],"b" 3}`, ""},
+		{`[1,2}`, ""},
+		{`[1,{"x":`, "/1"},
+	}
+
+	for _, test := range docs {
+		_, expectedErr := splitToMap(t, test.doc, SplitterOptions{})
+		_, err := splitToMap(t, test.doc, SplitterOptions{Parallelism: 2, ParallelChunkSize: 1})
+
+		var expected, actual *SyntaxError
+		require.True(t, errors.As(expectedErr, &expected), "%q", test.doc)
+		require.True(t, errors.As(err, &actual), "%q", test.doc)
+		require.Equal(t, test.path, expected.Path, "%q", test.doc)
+		require.Equal(t, expected.Path, actual.Path, "%q", test.doc)
+		require.Equal(t, expected.Position, actual.Position, "%q", test.doc)
+	}
+}
+
+func TestSplitParallelFallsBack(t *testing.T) {
+	const doc = `{"a": [1, 2]}`
+
+	s, err := NewSplitter(SplitterOptions{Reader: strings.NewReader(doc), OutputDir: "out", Parallelism: 2})
+	require.NoError(t, err)
+	_, _, _, ok := s.parallelInput()
+	require.True(t, ok)
+
+	fallbacks := []SplitterOptions{
+		{Reader: strings.NewReader(doc), Parallelism: 1},
+		{Reader: strings.NewReader(doc), Parallelism: 2, Strict: true},
+		{Reader: strings.NewReader(doc), Parallelism: 2, Paths: []string{"/a"}},
+		{Reader: strings.NewReader("\x1f\x8b\x08"), Parallelism: 2},
+		{Reader: strings.NewReader("\xff\xfe{\x00}\x00"), Parallelism: 2},
+		{Reader: io.MultiReader(strings.NewReader(doc)), Parallelism: 2},
+	}
+
+	for _, opts := range fallbacks {
+		opts.OutputDir = "out"
+		s, err := NewSplitter(opts)
+		require.NoError(t, err)
+		_, _, _, ok := s.parallelInput()
+		require.False(t, ok)
+	}
+}
+
+func BenchmarkSplitParallel(b *testing.B) {
+	discardLogs(b)
+	runShapeBenchmarks(b, func(b *testing.B, doc []byte) {
+		filename := filepath.Join(b.TempDir(), "doc.json")
+		require.NoError(b, os.WriteFile(filename, doc, 0644))
+
+		// at least 2 goroutines are used so that the parallel splitter is measured even with a single cpu
+		parallelism := max(runtime.GOMAXPROCS(0), 2)
+		for i := 0; i < b.N; i++ {
+			f, err := os.Open(filename)
+			require.NoError(b, err)
+
+			dir := b.TempDir()
+			s, err := NewSplitter(SplitterOptions{Reader: f, OutputDir: dir, Parallelism: parallelism})
+			require.NoError(b, err)
+			require.NoError(b, s.Split(context.Background()))
+			require.NoError(b, f.Close())
+
+			b.StopTimer()
+			require.NoError(b, os.RemoveAll(dir))
+			b.StartTimer()
+		}
+	})
+}
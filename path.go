@@ -0,0 +1,107 @@
+package jsplit
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ParsePath parses the path of a list to be extracted from a json document.  Paths may be given as a JSON Pointer
+// (RFC 6901) such as /data/records, or as dot separated keys such as response.items.  Only object keys are supported,
+// list indexes within a path are treated as keys.
+func ParsePath(path string) ([]string, error) {
+	if len(path) == 0 {
+		return nil, errors.New("empty path")
+	}
+
+	var segments []string
+	if path[0] == '/' {
+		segments = strings.Split(path[1:], "/")
+		for i, seg := range segments {
+			// per RFC 6901 ~1 is decoded before ~0 so that ~01 becomes ~1 rather than /
+			segments[i] = strings.ReplaceAll(strings.ReplaceAll(seg, "~1", "/"), "~0", "~")
+		}
+	} else {
+		segments = strings.Split(path, ".")
+	}
+
+	for _, seg := range segments {
+		if len(seg) == 0 {
+			return nil, fmt.Errorf("invalid path '%s'. Paths may not contain empty keys", path)
+		}
+	}
+
+	return segments, nil
+}
+
+// pathNode is a node in a tree of the paths being extracted from a json document.  Each node corresponds to an object
+// key, and nodes which are being extracted are leaves of the tree.
+type pathNode struct {
+	children map[string]*pathNode
+	// outputName is the name used for the jsonl files of a list which is being extracted. It is empty for nodes which
+	// are not extracted
+	outputName string
+}
+
+// newPathTree builds a tree from the supplied paths returning the root node.  A nil root is returned when no paths are
+// supplied, in which case every list in the root of the document is extracted.  Paths to different lists whose dot
+// separated keys are the same, such as /with.dot and with.dot, are rejected as their jsonl files would have the same
+// names.  Path separators within keys are escaped when the files are created, so keys such as a/b or .. can't write
+// files outside the output directory.
+func newPathTree(paths []string) (*pathNode, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	root := &pathNode{}
+	// extracted maps the output name of each extracted list to the first path given for it
+	extracted := make(map[string]string)
+	for _, path := range paths {
+		segments, err := ParsePath(path)
+		if err != nil {
+			return nil, err
+		}
+
+		node := root
+		for _, seg := range segments {
+			if len(node.outputName) != 0 {
+				return nil, fmt.Errorf("path '%s' is within a list which is already being extracted", path)
+			}
+
+			if node.children == nil {
+				node.children = make(map[string]*pathNode)
+			}
+
+			child, ok := node.children[seg]
+			if !ok {
+				child = &pathNode{}
+				node.children[seg] = child
+			}
+
+			node = child
+		}
+
+		if len(node.children) != 0 {
+			return nil, fmt.Errorf("path '%s' contains other paths being extracted", path)
+		}
+
+		outputName := strings.Join(segments, ".")
+		if other, ok := extracted[outputName]; ok && node.outputName != outputName {
+			return nil, fmt.Errorf("paths '%s' and '%s' would both be written to files named %s_00.jsonl", other, path, outputName)
+		}
+
+		extracted[outputName] = path
+		node.outputName = outputName
+	}
+
+	return root, nil
+}
+
+// child returns the node for the supplied key, or nil if no path goes through the key
+func (pn *pathNode) child(key string) *pathNode {
+	if pn == nil {
+		return nil
+	}
+
+	return pn.children[key]
+}
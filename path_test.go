@@ -0,0 +1,74 @@
+package jsplit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		expected []string
+	}{
+		{"/data/records", []string{"data", "records"}},
+		{"response.items", []string{"response", "items"}},
+		{"items", []string{"items"}},
+		{"/items", []string{"items"}},
+		{"/a~1b/c~0d/~01", []string{"a/b", "c~d", "~1"}},
+		{"/with.dot", []string{"with.dot"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			segments, err := ParsePath(test.path)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, segments)
+		})
+	}
+
+	for _, invalid := range []string{"", "/", "a..b", "/a//b", "a."} {
+		t.Run("invalid "+invalid, func(t *testing.T) {
+			_, err := ParsePath(invalid)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestNewPathTree(t *testing.T) {
+	root, err := newPathTree(nil)
+	require.NoError(t, err)
+	require.Nil(t, root)
+
+	root, err = newPathTree([]string{"/data/records", "data.users", "/other"})
+	require.NoError(t, err)
+	require.Equal(t, "data.records", root.child("data").child("records").outputName)
+	require.Equal(t, "data.users", root.child("data").child("users").outputName)
+	require.Equal(t, "other", root.child("other").outputName)
+	require.Empty(t, root.child("data").outputName)
+	require.Nil(t, root.child("missing"))
+
+	_, err = newPathTree([]string{"/data", "/data/records"})
+	require.Error(t, err)
+
+	_, err = newPathTree([]string{"/data/records", "/data"})
+	require.Error(t, err)
+
+	// the same list may be given more than once
+	root, err = newPathTree([]string{"/data/records", "data.records"})
+	require.NoError(t, err)
+	require.Equal(t, "data.records", root.child("data").child("records").outputName)
+
+	// different lists which would be written to the same files
+	_, err = newPathTree([]string{"/with.dot", "with.dot"})
+	require.EqualError(t, err, "paths '/with.dot' and 'with.dot' would both be written to files named with.dot_00.jsonl")
+
+	_, err = newPathTree([]string{"/a/b.c", "/a.b/c"})
+	require.Error(t, err)
+
+	// separators within keys are escaped when the files are named, so they're accepted
+	root, err = newPathTree([]string{"/a~1b", "/.."})
+	require.NoError(t, err)
+	require.Equal(t, "a/b", root.child("a/b").outputName)
+	require.Equal(t, "..", root.child("..").outputName)
+}
@@ -0,0 +1,353 @@
+package jsplit
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultProgressInterval is the interval between progress reports
+const DefaultProgressInterval = 10 * time.Second
+
+// ProgressSnapshot is the progress of a split at a point in time
+type ProgressSnapshot struct {
+	// Elapsed is the time since the split started
+	Elapsed time.Duration
+	// InputSize is the size of the input in bytes, or 0 when it is not known, such as when reading from a pipe
+	InputSize int64
+	// InputBytes is the number of bytes read from the input. For compressed input this is the compressed size
+	InputBytes int64
+	// DecodedBytes is the number of bytes of json read from the input once it has been decompressed and converted to
+	// UTF-8
+	DecodedBytes int64
+	// Items holds the number of items written to the jsonl files of each list, keyed by the name of the list
+	Items map[string]int64
+	// CurrentFile is the jsonl file most recently created
+	CurrentFile string
+}
+
+// TotalItems returns the number of items written to the jsonl files of every list
+func (ps ProgressSnapshot) TotalItems() int64 {
+	var total int64
+	for _, n := range ps.Items {
+		total += n
+	}
+
+	return total
+}
+
+// Percent returns the percentage of the input which has been read.  ok is false when the size of the input is not
+// known.
+func (ps ProgressSnapshot) Percent() (percent float64, ok bool) {
+	if ps.InputSize <= 0 {
+		return 0, false
+	}
+
+	return 100 * float64(ps.InputBytes) / float64(ps.InputSize), true
+}
+
+// BytesPerSecond returns the average rate at which the input has been read
+func (ps ProgressSnapshot) BytesPerSecond() float64 {
+	if ps.Elapsed <= 0 {
+		return 0
+	}
+
+	return float64(ps.InputBytes) / ps.Elapsed.Seconds()
+}
+
+// ETA returns the estimated time until the input has been read at the average rate it has been read so far.  ok is
+// false when the size of the input is not known or nothing has been read yet.
+func (ps ProgressSnapshot) ETA() (eta time.Duration, ok bool) {
+	rate := ps.BytesPerSecond()
+	if ps.InputSize <= 0 || rate == 0 {
+		return 0, false
+	}
+
+	remaining := ps.InputSize - ps.InputBytes
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return time.Duration(float64(remaining) / rate * float64(time.Second)), true
+}
+
+// String formats the snapshot as a single line such as
+//
+//	Progress: 42.1% of 2.6GiB read (9.8GiB decompressed) at 112.3 MB/s, ETA 13s, 1500 items (records: 1500), writing out/records_03.jsonl
+func (ps ProgressSnapshot) String() string {
+	var sb strings.Builder
+	sb.WriteString("Progress: ")
+	if percent, ok := ps.Percent(); ok {
+		fmt.Fprintf(&sb, "%.1f%% of %s read", percent, ByteSize(ps.InputSize).approxString())
+	} else {
+		fmt.Fprintf(&sb, "%s read", ByteSize(ps.InputBytes).approxString())
+	}
+
+	if ps.DecodedBytes != ps.InputBytes {
+		fmt.Fprintf(&sb, " (%s decompressed)", ByteSize(ps.DecodedBytes).approxString())
+	}
+
+	fmt.Fprintf(&sb, " at %.1f MB/s", ps.BytesPerSecond()/1e6)
+	if eta, ok := ps.ETA(); ok {
+		fmt.Fprintf(&sb, ", ETA %s", eta.Round(time.Second))
+	}
+
+	fmt.Fprintf(&sb, ", %d items", ps.TotalItems())
+	if len(ps.Items) > 0 {
+		names := make([]string, 0, len(ps.Items))
+		for name := range ps.Items {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		sb.WriteString(" (")
+		for i, name := range names {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+
+			fmt.Fprintf(&sb, "%s: %d", name, ps.Items[name])
+		}
+		sb.WriteString(")")
+	}
+
+	if len(ps.CurrentFile) != 0 {
+		fmt.Fprintf(&sb, ", writing %s", ps.CurrentFile)
+	}
+
+	return sb.String()
+}
+
+// LogValue implements slog.LogValuer so that a logged snapshot is resolved to a group of values rather than the line
+// returned by String.  Every slog handler resolves it, including slog.TextHandler which logs each value as a separate
+// attribute, so log String as the message when logging for people to read.
+func (ps ProgressSnapshot) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.Float64("elapsed_seconds", ps.Elapsed.Seconds()),
+		slog.Int64("input_bytes", ps.InputBytes),
+		slog.Int64("decoded_bytes", ps.DecodedBytes),
+		slog.Float64("mb_per_sec", ps.BytesPerSecond()/1e6),
+	}
+
+	if percent, ok := ps.Percent(); ok {
+		attrs = append(attrs, slog.Int64("input_size", ps.InputSize), slog.Float64("percent", percent))
+	}
+
+	if eta, ok := ps.ETA(); ok {
+		attrs = append(attrs, slog.Float64("eta_seconds", eta.Seconds()))
+	}
+
+	attrs = append(attrs, slog.Int64("total_items", ps.TotalItems()))
+	if len(ps.Items) > 0 {
+		names := make([]string, 0, len(ps.Items))
+		for name := range ps.Items {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		items := make([]any, len(names))
+		for i, name := range names {
+			items[i] = slog.Int64(name, ps.Items[name])
+		}
+
+		attrs = append(attrs, slog.Group("items", items...))
+	}
+
+	if len(ps.CurrentFile) != 0 {
+		attrs = append(attrs, slog.String("current_file", ps.CurrentFile))
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// progress holds the counters updated while a document is split.  They may be read by snapshot from any goroutine. The
+// methods which update the counters may be called on a nil *progress, which does nothing, so that the counting can be
+// disabled.
+type progress struct {
+	start     time.Time
+	inputSize int64
+
+	inputBytes   atomic.Int64
+	decodedBytes atomic.Int64
+
+	mu          sync.Mutex
+	items       map[string]*atomic.Int64
+	currentFile string
+}
+
+func newProgress(inputSize int64) *progress {
+	return &progress{
+		start:     time.Now(),
+		inputSize: inputSize,
+		items:     make(map[string]*atomic.Int64),
+	}
+}
+
+// snapshot returns the current progress
+func (p *progress) snapshot() ProgressSnapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	items := make(map[string]int64, len(p.items))
+	for name, n := range p.items {
+		items[name] = n.Load()
+	}
+
+	return ProgressSnapshot{
+		Elapsed:      time.Since(p.start),
+		InputSize:    p.inputSize,
+		InputBytes:   p.inputBytes.Load(),
+		DecodedBytes: p.decodedBytes.Load(),
+		Items:        items,
+		CurrentFile:  p.currentFile,
+	}
+}
+
+// report calls fn with a snapshot every interval until the returned function is called, which reports once more
+func (p *progress) report(fn func(ProgressSnapshot), interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				fn(p.snapshot())
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+		fn(p.snapshot())
+	}
+}
+
+// setRead sets the number of bytes which have been read.  It is used when the input is neither compressed nor
+// transcoded, so the number of bytes read from the input and the number decoded are the same.
+func (p *progress) setRead(n int64) {
+	if p != nil {
+		p.inputBytes.Store(n)
+		p.decodedBytes.Store(n)
+	}
+}
+
+func (p *progress) addDecoded(n int) {
+	if p != nil {
+		p.decodedBytes.Add(int64(n))
+	}
+}
+
+func (p *progress) setCurrentFile(filename string) {
+	if p != nil {
+		p.mu.Lock()
+		p.currentFile = filename
+		p.mu.Unlock()
+	}
+}
+
+// countItems wraps addFn, counting the items which are added to the named list.  Lists are only included in the
+// progress once an item has been added, as a writer is created for values which turn out not to be lists.
+func (p *progress) countItems(name string, addFn ListAddFunc) ListAddFunc {
+	if p == nil {
+		return addFn
+	}
+
+	var counter *atomic.Int64
+	return func(item []byte) error {
+		err := addFn(item)
+		if err != nil {
+			return err
+		}
+
+		if counter == nil {
+			counter = p.itemCounter(name)
+		}
+
+		counter.Add(1)
+		return nil
+	}
+}
+
+// itemCounter returns the counter of the items added to the named list
+func (p *progress) itemCounter(name string) *atomic.Int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	counter, ok := p.items[name]
+	if !ok {
+		counter = &atomic.Int64{}
+		p.items[name] = counter
+	}
+
+	return counter
+}
+
+// inputReader counts the bytes read from the input.  It wraps the io.Reader the input is read from, ahead of any
+// decompression.
+func (p *progress) inputReader(rd io.Reader) io.Reader {
+	if p == nil {
+		return rd
+	}
+
+	return &countingReader{rd: rd, n: &p.inputBytes}
+}
+
+// countingReader counts the bytes read from an io.Reader
+type countingReader struct {
+	rd io.Reader
+	n  *atomic.Int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.rd.Read(p)
+	cr.n.Add(int64(n))
+	return n, err
+}
+
+// remainingSize returns the number of bytes from the current position of rd to its end, or 0 if rd can't seek
+func remainingSize(rd io.Reader) int64 {
+	start, end, ok := seekRange(rd)
+	if !ok {
+		return 0
+	}
+
+	return end - start
+}
+
+// seekRange returns the current position of rd and the position of its end, leaving rd at its current position.  ok is
+// false if rd can't seek, as is the case for pipes and other streams.
+func seekRange(rd io.Reader) (start, end int64, ok bool) {
+	seeker, ok := rd.(io.Seeker)
+	if !ok {
+		return 0, 0, false
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	end, err = seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	_, err = seeker.Seek(start, io.SeekStart)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return start, end, true
+}
@@ -0,0 +1,182 @@
+package jsplit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressSnapshot(t *testing.T) {
+	ps := ProgressSnapshot{
+		Elapsed:      10 * time.Second,
+		InputSize:    4 << 30,
+		InputBytes:   1 << 30,
+		DecodedBytes: 3 << 30,
+		Items:        map[string]int64{"b": 2, "a": 40},
+		CurrentFile:  "out/b_03.jsonl",
+	}
+
+	percent, ok := ps.Percent()
+	require.True(t, ok)
+	require.Equal(t, 25.0, percent)
+
+	eta, ok := ps.ETA()
+	require.True(t, ok)
+	require.Equal(t, 30*time.Second, eta)
+
+	require.Equal(t, int64(42), ps.TotalItems())
+	require.Equal(t, "Progress: 25.0% of 4.0GiB read (3.0GiB decompressed) at 107.4 MB/s, ETA 30s, 42 items (a: 40, b: 2), writing out/b_03.jsonl", ps.String())
+
+	unknownSize := ProgressSnapshot{Elapsed: time.Second, InputBytes: 1536, DecodedBytes: 1536}
+	_, ok = unknownSize.Percent()
+	require.False(t, ok)
+	_, ok = unknownSize.ETA()
+	require.False(t, ok)
+	require.Equal(t, "Progress: 1.5KiB read at 0.0 MB/s, 0 items", unknownSize.String())
+}
+
+// splitWithProgress splits doc read from rd returning the snapshots reported while splitting
+func splitWithProgress(t *testing.T, rd io.Reader, opts SplitterOptions) []ProgressSnapshot {
+	var mu sync.Mutex
+	var snapshots []ProgressSnapshot
+
+	opts.Reader = rd
+	opts.OutputDir = t.TempDir()
+	opts.MaxItemsPerFile = 1000
+	opts.ProgressInterval = time.Millisecond
+	opts.OnProgress = func(ps ProgressSnapshot) {
+		mu.Lock()
+		defer mu.Unlock()
+		snapshots = append(snapshots, ps)
+	}
+
+	s, err := NewSplitter(opts)
+	require.NoError(t, err)
+	require.NoError(t, s.Split(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+	return snapshots
+}
+
+func TestSplitProgress(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(`{"name": "test", "a": [`)
+	for i := 0; i < 5000; i++ {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(`{"i": 1}`)
+	}
+	sb.WriteString(`], "b": [1, 2, 3]}`)
+	doc := sb.String()
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, err := gw.Write([]byte(doc))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	tests := []struct {
+		name       string
+		rd         io.Reader
+		opts       SplitterOptions
+		inputSize  int64
+		inputBytes int64
+	}{
+		{
+			name:       "uncompressed",
+			rd:         strings.NewReader(doc),
+			inputSize:  int64(len(doc)),
+			inputBytes: int64(len(doc)),
+		},
+		{
+			name:       "gzip",
+			rd:         bytes.NewReader(compressed.Bytes()),
+			inputSize:  int64(compressed.Len()),
+			inputBytes: int64(compressed.Len()),
+		},
+		{
+			name:       "parallel",
+			rd:         strings.NewReader(doc),
+			opts:       SplitterOptions{Parallelism: 2, ParallelChunkSize: 1000},
+			inputSize:  int64(len(doc)),
+			inputBytes: int64(len(doc)),
+		},
+		{
+			name:       "unknown size",
+			rd:         io.MultiReader(strings.NewReader(doc)),
+			inputBytes: int64(len(doc)),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshots := splitWithProgress(t, test.rd, test.opts)
+			require.NotEmpty(t, snapshots)
+
+			// the final snapshot is reported once the split is complete
+			final := snapshots[len(snapshots)-1]
+			require.Equal(t, test.inputSize, final.InputSize)
+			require.Equal(t, test.inputBytes, final.InputBytes)
+			require.Equal(t, int64(len(doc)), final.DecodedBytes)
+			require.Equal(t, map[string]int64{"a": 5000, "b": 3}, final.Items)
+			require.Equal(t, "b_00.jsonl", filepath.Base(final.CurrentFile))
+
+			for i := 1; i < len(snapshots); i++ {
+				require.GreaterOrEqual(t, snapshots[i].InputBytes, snapshots[i-1].InputBytes)
+				require.GreaterOrEqual(t, snapshots[i].TotalItems(), snapshots[i-1].TotalItems())
+			}
+		})
+	}
+}
+
+func TestProgressSnapshotLogValue(t *testing.T) {
+	ps := ProgressSnapshot{
+		Elapsed:      10 * time.Second,
+		InputSize:    4000,
+		InputBytes:   1000,
+		DecodedBytes: 3000,
+		Items:        map[string]int64{"b": 2, "a": 40},
+		CurrentFile:  "out/b_03.jsonl",
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("Progress", "progress", ps)
+
+	var logged struct {
+		Progress map[string]any `json:"progress"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+	require.Equal(t, map[string]any{
+		"elapsed_seconds": 10.0,
+		"input_bytes":     1000.0,
+		"decoded_bytes":   3000.0,
+		"mb_per_sec":      0.0001,
+		"input_size":      4000.0,
+		"percent":         25.0,
+		"eta_seconds":     30.0,
+		"total_items":     42.0,
+		"items":           map[string]any{"a": 40.0, "b": 2.0},
+		"current_file":    "out/b_03.jsonl",
+	}, logged.Progress)
+
+	// the size dependent values are omitted when the size of the input isn't known
+	buf.Reset()
+	logged.Progress = nil
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("Progress", "progress", ProgressSnapshot{Elapsed: time.Second})
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+	require.NotContains(t, logged.Progress, "percent")
+	require.NotContains(t, logged.Progress, "eta_seconds")
+	require.NotContains(t, logged.Progress, "items")
+}
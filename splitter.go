@@ -0,0 +1,295 @@
+package jsplit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+)
+
+const (
+	// DefaultSplitSize is the number of bytes written to a jsonl file before a new file is started
+	DefaultSplitSize = 4 * 1024 * 1024 * 1024
+	// DefaultReadBufferSize is the size of the chunks read from the input
+	DefaultReadBufferSize = 1024 * 1024
+	// DefaultWriteBufferSize is the size of the buffer used when writing each jsonl file
+	DefaultWriteBufferSize = 256 * 1024
+	// DefaultRootListName is the name used for the jsonl files of a document whose root is a list
+	DefaultRootListName = "items"
+)
+
+// SplitterOptions configures a Splitter
+type SplitterOptions struct {
+	// Reader is the source of the json document being split
+	Reader io.Reader
+	// Compression is the compression format of the data read from Reader. Defaults to CompressionAuto which detects
+	// the format from the start of the stream
+	Compression Compression
+	// Encoding is the character encoding of the decompressed data. Data which is not UTF-8 is converted to UTF-8 before
+	// it is parsed and any byte order mark is removed. Defaults to EncodingAuto which detects the encoding from the
+	// start of the stream
+	Encoding Encoding
+	// OutputDir is the directory root.json and the jsonl files are written to. It must already exist
+	OutputDir string
+	// SplitSize is the number of bytes written to a jsonl file before a new file is started. Defaults to
+	// DefaultSplitSize unless MaxItemsPerFile is set, in which case 0 means there is no size limit
+	SplitSize uint64
+	// MaxItemsPerFile is the maximum number of items written to a jsonl file before a new file is started. 0 means there
+	// is no item limit
+	MaxItemsPerFile int
+	// ReadBufferSize is the size of the chunks read from Reader. Defaults to DefaultReadBufferSize
+	ReadBufferSize int
+	// WriteBufferSize is the size of the buffer used when writing each jsonl file. Defaults to DefaultWriteBufferSize
+	WriteBufferSize int
+	// WriterGoroutines is the number of goroutines used to write and compress the jsonl files while the document is
+	// parsed. 0 writes the files on the parsing goroutine
+	WriterGoroutines int
+	// WriterQueueSize is the number of batches of items which may be queued for each list when WriterGoroutines is
+	// set before parsing waits for them to be written. Defaults to DefaultWriterQueueSize
+	WriterQueueSize int
+	// OutputCompression is the compression format used for the jsonl files. Only CompressionNone, CompressionGzip and
+	// CompressionZstd are supported. Defaults to CompressionNone
+	OutputCompression Compression
+	// Paths are the paths of the lists which are extracted to jsonl files, given as JSON Pointers such as /data/records
+	// or dot separated keys such as response.items. Everything else is written to root.json. Defaults to extracting
+	// every list in the root of the document.
+	Paths []string
+	// RootListName is the name used for the jsonl files when the root of the document is a list rather than an object.
+	// The files are named [RootListName]_%02d.jsonl. Defaults to DefaultRootListName
+	RootListName string
+	// Strict enables full validation of the document as defined by RFC 8259 while it is split. Splitting fails with a
+	// *SyntaxError on the first violation, guaranteeing every line written is valid json
+	Strict bool
+	// ControlChars controls how raw control characters such as line breaks inside strings are handled when Strict is
+	// false. Defaults to ControlCharEscape
+	ControlChars ControlCharMode
+	// InvalidUTF8 controls how items which are not valid UTF-8 are handled. Only the items of extracted lists are
+	// checked, root.json is written unchanged. Defaults to InvalidUTF8Ignore
+	InvalidUTF8 InvalidUTF8Mode
+	// Parallelism is the number of goroutines used to parse the lists of the document when it is greater than 1.  The
+	// document is indexed to find the items of each list in its root, and chunks of items are parsed concurrently then
+	// written in their original order. Only uncompressed UTF-8 documents read from an io.ReadSeeker which is also an
+	// io.ReaderAt, such as an *os.File, are split in parallel, and only when Paths and Strict are not set. Other
+	// documents are split sequentially
+	Parallelism int
+	// ParallelChunkSize is the number of bytes of list items parsed by each job when splitting in parallel. Defaults to
+	// DefaultParallelChunkSize
+	ParallelChunkSize int
+	// SplitOnCompressedSize applies SplitSize to the compressed size of the jsonl files rather than the size of the json
+	// written to them
+	SplitOnCompressedSize bool
+	// OnProgress is called with the progress of the split every ProgressInterval, and once more when the split
+	// finishes. It is called from a separate goroutine. Progress is not tracked when it is nil
+	OnProgress func(ProgressSnapshot)
+	// ProgressInterval is the interval between calls to OnProgress. Defaults to DefaultProgressInterval
+	ProgressInterval time.Duration
+	// Logger receives the messages logged while splitting, such as each jsonl file being closed. Detail such as each
+	// file being created is logged at slog.LevelDebug. Defaults to slog.Default()
+	Logger *slog.Logger
+
+	// progress holds the counters reported to OnProgress while splitting
+	progress *progress
+}
+
+func (opts *SplitterOptions) setDefaults() {
+	if opts.Compression == "" {
+		opts.Compression = CompressionAuto
+	}
+
+	if opts.Encoding == "" {
+		opts.Encoding = EncodingAuto
+	}
+
+	if opts.SplitSize == 0 && opts.MaxItemsPerFile <= 0 {
+		opts.SplitSize = DefaultSplitSize
+	}
+
+	if opts.ReadBufferSize <= 0 {
+		opts.ReadBufferSize = DefaultReadBufferSize
+	}
+
+	if opts.WriteBufferSize <= 0 {
+		opts.WriteBufferSize = DefaultWriteBufferSize
+	}
+
+	if opts.WriterQueueSize <= 0 {
+		opts.WriterQueueSize = DefaultWriterQueueSize
+	}
+
+	if opts.ParallelChunkSize <= 0 {
+		opts.ParallelChunkSize = DefaultParallelChunkSize
+	}
+
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = DefaultProgressInterval
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+
+	if len(opts.RootListName) == 0 {
+		opts.RootListName = DefaultRootListName
+	}
+
+	if opts.OutputCompression == "" {
+		opts.OutputCompression = CompressionNone
+	}
+
+	if opts.InvalidUTF8 == "" {
+		opts.InvalidUTF8 = InvalidUTF8Ignore
+	}
+
+	if opts.ControlChars == "" {
+		opts.ControlChars = ControlCharEscape
+	}
+}
+
+func (opts *SplitterOptions) splitThreshold() SplitThreshold {
+	return SplitThreshold{
+		Size:       opts.SplitSize,
+		Items:      opts.MaxItemsPerFile,
+		Compressed: opts.SplitOnCompressedSize,
+	}
+}
+
+// Splitter splits a json document into a root.json file and jsonl files for each of the lists in the root of the
+// document.  Documents whose root is a list are split into jsonl files containing the list's items.
+type Splitter struct {
+	opts SplitterOptions
+}
+
+// NewSplitter returns a *Splitter configured with the supplied options. Zero valued sizes are replaced with their
+// defaults.
+func NewSplitter(opts SplitterOptions) (*Splitter, error) {
+	if opts.Reader == nil {
+		return nil, errors.New("a reader is required")
+	}
+
+	if len(opts.OutputDir) == 0 {
+		return nil, errors.New("an output directory is required")
+	}
+
+	err := ValidateOutputCompression(opts.OutputCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = newPathTree(opts.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.Encoding, err = ParseEncoding(string(opts.Encoding))
+	if err != nil {
+		return nil, err
+	}
+
+	opts.InvalidUTF8, err = ParseInvalidUTF8Mode(string(opts.InvalidUTF8))
+	if err != nil {
+		return nil, err
+	}
+
+	opts.ControlChars, err = ParseControlCharMode(string(opts.ControlChars))
+	if err != nil {
+		return nil, err
+	}
+
+	opts.setDefaults()
+	return &Splitter{opts: opts}, nil
+}
+
+// Split reads the json document from the configured reader and writes the split files to the output directory
+func (s *Splitter) Split(ctx context.Context) error {
+	opts := s.opts
+	ra, start, end, parallel := s.parallelInput()
+
+	if opts.OnProgress != nil {
+		size := end - start
+		if !parallel {
+			size = remainingSize(opts.Reader)
+		}
+
+		opts.progress = newProgress(size)
+		stop := opts.progress.report(opts.OnProgress, opts.ProgressInterval)
+		defer stop()
+	}
+
+	if parallel {
+		opts.Logger.Debug("Splitting in parallel", "goroutines", opts.Parallelism, "chunk_size", opts.ParallelChunkSize)
+		return splitParallel(ctx, ra, start, end, opts)
+	} else if opts.Parallelism > 1 {
+		opts.Logger.Debug("Splitting sequentially as the input can't be split in parallel")
+	}
+
+	rd, err := AsyncReaderFromReaderWithEncoding(opts.Reader, opts.ReadBufferSize, opts.Compression, opts.Encoding)
+	if err != nil {
+		return err
+	}
+
+	rd.progress = opts.progress
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		// stop the reader and wait for it so the caller's reader is no longer in use once Split returns
+		cancel()
+		rd.Wait()
+	}()
+
+	ctx = rd.Start(ctx)
+	return splitStream(ctx, rd, opts)
+}
+
+// parallelInput returns the io.ReaderAt and the range of it holding the document when the document can be split in
+// parallel.  Any UTF-8 byte order mark is excluded from the range.
+func (s *Splitter) parallelInput() (io.ReaderAt, int64, int64, bool) {
+	opts := s.opts
+	if opts.Parallelism <= 1 || len(opts.Paths) != 0 || opts.Strict {
+		return nil, 0, 0, false
+	}
+
+	if opts.Compression != CompressionAuto && opts.Compression != CompressionNone {
+		return nil, 0, 0, false
+	}
+
+	if opts.Encoding != EncodingAuto && opts.Encoding != EncodingUTF8 {
+		return nil, 0, 0, false
+	}
+
+	ra, ok := opts.Reader.(io.ReaderAt)
+	if !ok {
+		return nil, 0, 0, false
+	}
+
+	// pipes and other streams which can't seek are split sequentially
+	start, end, ok := seekRange(opts.Reader)
+	if !ok {
+		return nil, 0, 0, false
+	}
+
+	br := bufio.NewReaderSize(io.NewSectionReader(ra, start, end-start), 16)
+	if opts.Compression == CompressionAuto {
+		c, err := DetectCompression(br)
+		if err != nil || c != CompressionNone {
+			return nil, 0, 0, false
+		}
+	}
+
+	e, bomLen, err := DetectEncoding(br)
+	if err != nil {
+		return nil, 0, 0, false
+	}
+
+	if e != EncodingUTF8 {
+		if opts.Encoding == EncodingAuto {
+			return nil, 0, 0, false
+		}
+
+		// the encoding was given as UTF-8 so the data is not transcoded, and only a UTF-8 byte order mark is removed
+		bomLen = 0
+	}
+
+	return ra, start + int64(bomLen), end, true
+}
@@ -0,0 +1,263 @@
+package jsplit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSplitterValidation(t *testing.T) {
+	_, err := NewSplitter(SplitterOptions{OutputDir: "out"})
+	require.Error(t, err)
+
+	_, err = NewSplitter(SplitterOptions{Reader: strings.NewReader("{}")})
+	require.Error(t, err)
+
+	_, err = NewSplitter(SplitterOptions{Reader: strings.NewReader("{}"), OutputDir: "out", InvalidUTF8: "drop"})
+	require.Error(t, err)
+
+	_, err = NewSplitter(SplitterOptions{Reader: strings.NewReader("{}"), OutputDir: "out", ControlChars: "strip"})
+	require.Error(t, err)
+
+	s, err := NewSplitter(SplitterOptions{Reader: strings.NewReader("{}"), OutputDir: "out"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(DefaultSplitSize), s.opts.SplitSize)
+	require.Equal(t, DefaultReadBufferSize, s.opts.ReadBufferSize)
+	require.Equal(t, DefaultWriteBufferSize, s.opts.WriteBufferSize)
+	require.Equal(t, InvalidUTF8Ignore, s.opts.InvalidUTF8)
+	require.Equal(t, ControlCharEscape, s.opts.ControlChars)
+}
+
+func TestSplitter(t *testing.T) {
+	const doc = `{"name": "test", "items": [{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}]}`
+
+	tempDir := t.TempDir()
+	s, err := NewSplitter(SplitterOptions{
+		Reader:         strings.NewReader(doc),
+		OutputDir:      tempDir,
+		SplitSize:      16,
+		ReadBufferSize: 7,
+	})
+	require.NoError(t, err)
+
+	err = s.Split(context.Background())
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(tempDir, "root.json"), "{\n\t\"name\":\"test\"\n}")
+	requireContents(t, filepath.Join(tempDir, "items_00.jsonl"), "{\"id\":1}\n{\"id\":2}")
+	requireContents(t, filepath.Join(tempDir, "items_01.jsonl"), "{\"id\":3}\n{\"id\":4}")
+}
+
+// cancellingReader returns the start of a list, then cancels the split and returns list items indefinitely
+type cancellingReader struct {
+	cancel  context.CancelFunc
+	started bool
+}
+
+func (cr *cancellingReader) Read(p []byte) (int, error) {
+	if !cr.started {
+		cr.started = true
+		return copy(p, `{"items": [`), nil
+	}
+
+	cr.cancel()
+	return copy(p, `1, `), nil
+}
+
+func TestSplitterCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := NewSplitter(SplitterOptions{
+		Reader:    &cancellingReader{cancel: cancel},
+		OutputDir: t.TempDir(),
+	})
+	require.NoError(t, err)
+
+	err = s.Split(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSplitterTruncatedGzip(t *testing.T) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, err := fmt.Fprintf(gw, `{"name": "test", "items": [%s1]}`, strings.Repeat("1, ", 10000))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	// the compressed stream ends part way through the list
+	truncated := buf.Bytes()[:buf.Len()/2]
+	for _, c := range []Compression{CompressionAuto, CompressionGzip} {
+		s, err := NewSplitter(SplitterOptions{
+			Reader:      bytes.NewReader(truncated),
+			OutputDir:   t.TempDir(),
+			Compression: c,
+		})
+		require.NoError(t, err)
+
+		err = s.Split(context.Background())
+		require.ErrorIs(t, err, io.ErrUnexpectedEOF, "compression %s", c)
+	}
+}
+
+func TestSplitterOutputCompression(t *testing.T) {
+	const doc = `{"items": [{"id": 1}, {"id": 2}, {"id": 3}]}`
+
+	for _, c := range []Compression{CompressionGzip, CompressionZstd} {
+		t.Run(string(c), func(t *testing.T) {
+			tempDir := t.TempDir()
+			s, err := NewSplitter(SplitterOptions{
+				Reader:            strings.NewReader(doc),
+				OutputDir:         tempDir,
+				OutputCompression: c,
+			})
+			require.NoError(t, err)
+			require.NoError(t, s.Split(context.Background()))
+
+			f, err := OpenFile(filepath.Join(tempDir, "items_00.jsonl"+c.Extension()))
+			require.NoError(t, err)
+			defer f.Close()
+
+			data, err := io.ReadAll(f)
+			require.NoError(t, err)
+			require.Equal(t, "{\"id\":1}\n{\"id\":2}\n{\"id\":3}", string(data))
+		})
+	}
+
+	_, err := NewSplitter(SplitterOptions{Reader: strings.NewReader(doc), OutputDir: "out", OutputCompression: CompressionXz})
+	require.Error(t, err)
+}
+
+func TestSplitterWriterGoroutines(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString(`{"name": "test"`)
+	for _, key := range []string{"a", "b", "c"} {
+		sb.WriteString(`, "` + key + `": [`)
+		for i := 0; i < 5000; i++ {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			sb.WriteString(`{"key": "` + key + `", "i": ` + strconv.Itoa(i) + `}`)
+		}
+		sb.WriteString(`]`)
+	}
+	sb.WriteString(`}`)
+	doc := sb.String()
+
+	split := func(t *testing.T, writers int) string {
+		tempDir := t.TempDir()
+		s, err := NewSplitter(SplitterOptions{
+			Reader:            strings.NewReader(doc),
+			OutputDir:         tempDir,
+			MaxItemsPerFile:   1500,
+			OutputCompression: CompressionGzip,
+			WriterGoroutines:  writers,
+			WriterQueueSize:   2,
+		})
+		require.NoError(t, err)
+		require.NoError(t, s.Split(context.Background()))
+		return tempDir
+	}
+
+	syncDir := split(t, 0)
+	asyncDir := split(t, 2)
+
+	for _, key := range []string{"a", "b", "c"} {
+		for i := 0; i < 4; i++ {
+			name := fmt.Sprintf("%s_%02d.jsonl.gz", key, i)
+			requireSameContents(t, filepath.Join(syncDir, name), filepath.Join(asyncDir, name))
+		}
+	}
+
+	requireContents(t, filepath.Join(asyncDir, "root.json"), "{\n\t\"name\":\"test\"\n}")
+}
+
+// requireSameContents requires that two files contain the same data once decompressed
+func requireSameContents(t *testing.T, expectedFile, actualFile string) {
+	read := func(filename string) []byte {
+		f, err := OpenFile(filename)
+		require.NoError(t, err)
+		defer f.Close()
+
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		return data
+	}
+
+	require.Equal(t, string(read(expectedFile)), string(read(actualFile)), actualFile)
+}
+
+func TestSplitterLogger(t *testing.T) {
+	const doc = `{"name": "test", "items": [{"id": 1}, {"id": 2}, {"id": 3}]}`
+
+	// split logs the messages logged at level or above, decoded from the json lines written by the logger
+	split := func(t *testing.T, level slog.Level, parallelism int) []map[string]any {
+		var buf bytes.Buffer
+		tempDir := t.TempDir()
+		filename := filepath.Join(tempDir, "doc.json")
+		require.NoError(t, os.WriteFile(filename, []byte(doc), 0644))
+
+		f, err := os.Open(filename)
+		require.NoError(t, err)
+		defer f.Close()
+
+		s, err := NewSplitter(SplitterOptions{
+			Reader:            f,
+			OutputDir:         filepath.Join(tempDir, "out"),
+			Parallelism:       parallelism,
+			ParallelChunkSize: 8,
+			Logger:            slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})),
+		})
+		require.NoError(t, err)
+		require.NoError(t, os.Mkdir(filepath.Join(tempDir, "out"), os.ModePerm))
+		require.NoError(t, s.Split(context.Background()))
+
+		var messages []map[string]any
+		dec := json.NewDecoder(&buf)
+		for dec.More() {
+			var msg map[string]any
+			require.NoError(t, dec.Decode(&msg))
+			messages = append(messages, msg)
+		}
+
+		return messages
+	}
+
+	msgs := func(messages []map[string]any) []string {
+		var result []string
+		for _, m := range messages {
+			result = append(result, m["msg"].(string))
+		}
+
+		return result
+	}
+
+	for _, parallelism := range []int{1, 2} {
+		t.Run(fmt.Sprintf("parallelism %d", parallelism), func(t *testing.T) {
+			messages := split(t, slog.LevelInfo, parallelism)
+			require.Equal(t, []string{"Closing file", "Wrote root values", "Completed"}, msgs(messages))
+			require.Equal(t, "items_00.jsonl", filepath.Base(messages[0]["file"].(string)))
+			require.Equal(t, "root.json", filepath.Base(messages[1]["file"].(string)))
+			require.Contains(t, messages[2], "seconds")
+
+			debug := msgs(split(t, slog.LevelDebug, parallelism))
+			require.Contains(t, debug, "Creating file")
+			if parallelism > 1 {
+				require.Contains(t, debug, "Splitting in parallel")
+			}
+
+			require.Empty(t, split(t, slog.LevelWarn, parallelism))
+		})
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package jsplit
 
 import (
 	"errors"
@@ -10,23 +10,48 @@ var newLineBytes = []byte{byte('\n')}
 // CreateWriterFn is used for creating new io.WriteCloser objects for writing the split json files
 type CreateWriterFn func() (io.WriteCloser, error)
 
+// FileSizer is implemented by streams which can report the number of bytes that have been written to the underlying
+// file, such as *BufferedWriteCloser when it is compressing its output
+type FileSizer interface {
+	FileSize() uint64
+}
+
+// SplitThreshold controls when a SplittingJsonlWriter closes its current stream and creates a new one.  When both Size
+// and Items are set a new stream is created when either is reached.
+type SplitThreshold struct {
+	// Size is the number of bytes after which a new stream is created. 0 means there is no size limit
+	Size uint64
+	// Items is the maximum number of items written to a stream. 0 means there is no item limit
+	Items int
+	// Compressed applies Size to the number of bytes written to the underlying file, as reported by streams which
+	// implement FileSizer, rather than to the number of bytes of json written
+	Compressed bool
+}
+
 // SplittingJsonlWriter receives json objects one at a time, and it writes these objects in jsonl format to a series of
 // files closing streams and creating new ones any time a size threshold is reached
 type SplittingJsonlWriter struct {
 	createWriter CreateWriterFn
 	wr           io.WriteCloser
 
-	splitSize    uint64
+	threshold    SplitThreshold
 	writtenBytes uint64
 	writtenItems int
 }
 
 // NewSplittingJsonlWriter returns a *SplittingJsonlWriter which creates streams using the supplied function.  These streams
-// are closed and new ones created any time a stream has had more than splitSize bytes written to it
+// are closed and new ones created any time a stream has had more than splitSize bytes written to it. A splitSize of 0
+// writes all items to a single stream
 func NewSplittingJsonlWriter(createWriter CreateWriterFn, splitSize uint64) *SplittingJsonlWriter {
+	return NewSplittingJsonlWriterWithThreshold(createWriter, SplitThreshold{Size: splitSize})
+}
+
+// NewSplittingJsonlWriterWithThreshold returns a *SplittingJsonlWriter which creates streams using the supplied
+// function.  These streams are closed and new ones created any time the supplied threshold is reached
+func NewSplittingJsonlWriterWithThreshold(createWriter CreateWriterFn, threshold SplitThreshold) *SplittingJsonlWriter {
 	return &SplittingJsonlWriter{
 		createWriter: createWriter,
-		splitSize:    splitSize,
+		threshold:    threshold,
 		writtenBytes: 0,
 		writtenItems: 0,
 	}
@@ -64,8 +89,10 @@ func (sjwr *SplittingJsonlWriter) Add(item []byte) error {
 	sjwr.writtenItems++
 	sjwr.writtenBytes += uint64(len(item))
 
-	if sjwr.writtenBytes >= sjwr.splitSize {
-		err := sjwr.newWriter()
+	if sjwr.thresholdReached() {
+		// the next stream is created by the next call to Add so no empty stream is left behind when the last item
+		// lands exactly on the threshold
+		err := sjwr.Close()
 		if err != nil {
 			return err
 		}
@@ -74,6 +101,24 @@ func (sjwr *SplittingJsonlWriter) Add(item []byte) error {
 	return nil
 }
 
+func (sjwr *SplittingJsonlWriter) thresholdReached() bool {
+	if sjwr.threshold.Items > 0 && sjwr.writtenItems >= sjwr.threshold.Items {
+		return true
+	}
+
+	if sjwr.threshold.Size == 0 {
+		return false
+	}
+
+	if sjwr.threshold.Compressed {
+		if sizer, ok := sjwr.wr.(FileSizer); ok {
+			return sizer.FileSize() >= sjwr.threshold.Size
+		}
+	}
+
+	return sjwr.writtenBytes >= sjwr.threshold.Size
+}
+
 // Close closes the last stream making sure all the data has been flushed
 func (sjwr *SplittingJsonlWriter) Close() error {
 	if sjwr.wr != nil {
@@ -1,7 +1,8 @@
-package main
+package jsplit
 
 import (
 	"bytes"
+	"encoding/json"
 	"github.com/stretchr/testify/require"
 	"io"
 	"strings"
@@ -58,3 +59,117 @@ func TestSplittingJSONLWriter(t *testing.T) {
 		require.Equal(t, expectedVal, string(bs))
 	}
 }
+
+// SizedBufWriteCloser simulates compression by reporting a file size which grows by 10 bytes per write
+type SizedBufWriteCloser struct {
+	*BufWriteCloser
+	fileSize uint64
+}
+
+func (sbwc *SizedBufWriteCloser) Write(p []byte) (int, error) {
+	sbwc.fileSize += 10
+	return sbwc.BufWriteCloser.Write(p)
+}
+
+func (sbwc *SizedBufWriteCloser) FileSize() uint64 {
+	return sbwc.fileSize
+}
+
+func TestSplittingJSONLWriterCompressedThreshold(t *testing.T) {
+	var buffers []*SizedBufWriteCloser
+
+	createWriter := func() (io.WriteCloser, error) {
+		buf := &SizedBufWriteCloser{BufWriteCloser: NewBufWriteCloser()}
+		buffers = append(buffers, buf)
+		return buf, nil
+	}
+
+	wr := NewSplittingJsonlWriterWithThreshold(createWriter, SplitThreshold{Size: 100, Compressed: true})
+
+	// the first item is a single write and each subsequent item is a write of a newline followed by the item, so the
+	// 6th item takes the file size to 110 bytes
+	item := []byte(`{"k": "a value which is longer than the split size if it were measured uncompressed"}`)
+	for i := 0; i < 6; i++ {
+		require.NoError(t, wr.Add(item))
+	}
+
+	require.Len(t, buffers, 1)
+
+	require.NoError(t, wr.Add(item))
+	require.Len(t, buffers, 2)
+	require.NoError(t, wr.Close())
+}
+
+func TestSplittingJSONLWriterItemThreshold(t *testing.T) {
+	tests := []struct {
+		name          string
+		threshold     SplitThreshold
+		numItems      int
+		expectedFiles int
+	}{
+		{"items only", SplitThreshold{Items: 5}, 20, 4},
+		{"items only partial file", SplitThreshold{Items: 5}, 22, 5},
+		{"items before size", SplitThreshold{Items: 2, Size: 1024}, 10, 5},
+		{"size before items", SplitThreshold{Items: 100, Size: 8}, 10, 5},
+		{"no limits", SplitThreshold{}, 10, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buffers []*BufWriteCloser
+			createWriter := func() (io.WriteCloser, error) {
+				buf := NewBufWriteCloser()
+				buffers = append(buffers, buf)
+				return buf, nil
+			}
+
+			wr := NewSplittingJsonlWriterWithThreshold(createWriter, test.threshold)
+			for i := 0; i < test.numItems; i++ {
+				require.NoError(t, wr.Add([]byte(`"ab"`)))
+			}
+			require.NoError(t, wr.Close())
+
+			require.Len(t, buffers, test.expectedFiles)
+			for _, buf := range buffers {
+				require.NotZero(t, buf.Len())
+			}
+		})
+	}
+}
+
+func BenchmarkSplittingJsonlWriter(b *testing.B) {
+	runShapeBenchmarks(b, func(b *testing.B, doc []byte) {
+		discardLogs(b)
+
+		// the items of every list in the document are written to a single writer
+		var root map[string]json.RawMessage
+		require.NoError(b, json.Unmarshal(doc, &root))
+
+		var items []json.RawMessage
+		for _, val := range root {
+			var list []json.RawMessage
+			if json.Unmarshal(val, &list) == nil {
+				items = append(items, list...)
+			}
+		}
+
+		for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+			b.Run(string(compression), func(b *testing.B) {
+				b.SetBytes(int64(len(doc)))
+				b.ReportAllocs()
+
+				createWriter := func() (io.WriteCloser, error) {
+					return NewCompressingBufferedWriteCloser("discard", nopWriteCloser{io.Discard}, DefaultWriteBufferSize, compression)
+				}
+
+				for i := 0; i < b.N; i++ {
+					wr := NewSplittingJsonlWriterWithThreshold(createWriter, SplitThreshold{Size: 4 << 20, Compressed: compression != CompressionNone})
+					for _, item := range items {
+						require.NoError(b, wr.Add(item))
+					}
+					require.NoError(b, wr.Close())
+				}
+			})
+		}
+	})
+}
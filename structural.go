@@ -0,0 +1,235 @@
+package jsplit
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// The structural index classifies the bytes of 64 byte blocks using bitmaps with one bit per byte, in the manner of the
+// first stage of simdjson.  The bytes of a block are loaded eight at a time into uint64 words and compared using SWAR
+// (SIMD within a register) arithmetic, so the strings, whitespace and brackets of a block are found without branching
+// on each byte.  Blocks containing anything the index doesn't handle are left to be scanned a byte at a time.
+
+const (
+	blockSize = 64
+
+	lsbs = 0x0101010101010101
+	msbs = 0x8080808080808080
+	lows = 0x7f7f7f7f7f7f7f7f
+
+	// evenBits has a bit set for each even position in a block
+	evenBits = 0x5555555555555555
+	// moveMaskMagic gathers the high bit of each byte of a word into the top byte when it multiplies the word shifted
+	// right by 7
+	moveMaskMagic = 0x0102040810204080
+)
+
+// eqBytes sets the high bit of each byte of w which equals ch
+func eqBytes(w uint64, ch byte) uint64 {
+	x := w ^ uint64(ch)*lsbs
+	return ^(((x & lows) + lows) | x) & msbs
+}
+
+// ltBytes sets the high bit of each byte of w which is less than n.  n must not exceed 0x80.
+func ltBytes(w uint64, n byte) uint64 {
+	return ^((w | msbs) - uint64(n)*lsbs) & ^w & msbs
+}
+
+// moveMask gathers the high bit of each byte of w into an 8 bit mask, with the first byte in the lowest bit
+func moveMask(w uint64) uint64 {
+	return ((w >> 7) * moveMaskMagic) >> 56
+}
+
+// blockMasks holds the bitmaps of a block.  Bit i of each mask describes byte i of the block.
+type blockMasks struct {
+	quote     uint64
+	backslash uint64
+	control   uint64
+	space     uint64
+	open      uint64
+	close     uint64
+}
+
+// classifyBlock builds the bitmaps of a 64 byte block
+func classifyBlock(block []byte) blockMasks {
+	var m blockMasks
+	_ = block[blockSize-1]
+	for i := 0; i < blockSize; i += 8 {
+		w := binary.LittleEndian.Uint64(block[i:])
+		// '{' and '[' differ only in the 0x20 bit, as do '}' and ']'
+		folded := w | 0x20*lsbs
+
+		shift := uint(i)
+		m.quote |= moveMask(eqBytes(w, QM)) << shift
+		m.backslash |= moveMask(eqBytes(w, Escape)) << shift
+		m.control |= moveMask(ltBytes(w, 0x20)) << shift
+		m.space |= moveMask(eqBytes(w, SPACE)) << shift
+		m.open |= moveMask(eqBytes(folded, OpenCB)) << shift
+		m.close |= moveMask(eqBytes(folded, CloseCB)) << shift
+	}
+
+	return m
+}
+
+// classifyStringBlock builds only the bitmaps of a 64 byte block needed to find the end of a string
+func classifyStringBlock(block []byte) blockMasks {
+	var m blockMasks
+	_ = block[blockSize-1]
+	for i := 0; i < blockSize; i += 8 {
+		w := binary.LittleEndian.Uint64(block[i:])
+
+		shift := uint(i)
+		m.quote |= moveMask(eqBytes(w, QM)) << shift
+		m.backslash |= moveMask(eqBytes(w, Escape)) << shift
+		m.control |= moveMask(ltBytes(w, 0x20)) << shift
+	}
+
+	return m
+}
+
+// escapedChars returns a mask of the bytes which are escaped by a preceding backslash, given the mask of backslashes in
+// the block.  prevEscaped is 1 when the first byte of the block is escaped, and is updated for the next block.
+func escapedChars(backslash uint64, prevEscaped *uint64) uint64 {
+	// a backslash which is itself escaped does not start a sequence
+	backslash &^= *prevEscaped
+	followsEscape := backslash<<1 | *prevEscaped
+
+	// adding the starts of the sequences which begin on odd bits to the backslashes carries through each sequence,
+	// leaving the bit after it set when the sequence has an odd length
+	oddSequenceStarts := backslash &^ evenBits &^ followsEscape
+	sequencesStartingOnEvenBits, overflow := bits.Add64(oddSequenceStarts, backslash, 0)
+	*prevEscaped = overflow
+
+	invertMask := sequencesStartingOnEvenBits << 1
+	return (evenBits ^ invertMask) & followsEscape
+}
+
+// prefixXor sets each bit of the result to the parity of the bits of x at or below its position
+func prefixXor(x uint64) uint64 {
+	x ^= x << 1
+	x ^= x << 2
+	x ^= x << 4
+	x ^= x << 8
+	x ^= x << 16
+	x ^= x << 32
+	return x
+}
+
+// lowBits returns a mask of the bits below bit n
+func lowBits(n int) uint64 {
+	return 1<<uint(n) - 1
+}
+
+// scanStringBlock continues a string over a 64 byte block. escaped is set when the first byte of the block is escaped
+// and is updated for the next block.  It returns the number of bytes consumed, which includes the closing quote when
+// found is true.  ok is false, with nothing consumed, when the string contains a control character within the block.
+func scanStringBlock(block []byte, escaped *bool) (n int, found, ok bool) {
+	m := classifyStringBlock(block)
+
+	var prevEscaped uint64
+	if *escaped {
+		prevEscaped = 1
+	}
+
+	quotes := m.quote &^ escapedChars(m.backslash, &prevEscaped)
+	if quotes != 0 {
+		end := bits.TrailingZeros64(quotes)
+		if m.control&lowBits(end) != 0 {
+			return 0, false, false
+		}
+
+		*escaped = false
+		return end + 1, true, true
+	}
+
+	if m.control != 0 {
+		return 0, false, false
+	}
+
+	*escaped = prevEscaped != 0
+	return blockSize, false, true
+}
+
+// scanObjectBlock continues ParseObject over a 64 byte block, appending it to objBuf with the whitespace outside of
+// strings removed.  The brackets opened since the start of the object are on the open stack, inString is set when the
+// block starts within a string and escaped when its first byte is escaped, and both are updated for the next block.  It
+// returns the number of bytes consumed, which is less than the block when the object is closed by the byte matching
+// closeCh, in which case closed is true.  ok is false, with nothing consumed, when the block contains something the
+// index doesn't handle: a backslash outside of a string, a control character within one, or a 0 byte.
+func (p *Parser) scanObjectBlock(block []byte, closeCh byte, inString, escaped *bool) (n int, closed, ok bool) {
+	m := classifyBlock(block)
+
+	var prevEscaped uint64
+	if *escaped {
+		prevEscaped = 1
+	}
+
+	// stringMask covers the opening quote and contents of each string, but not the closing quote
+	stringMask := prefixXor(m.quote &^ escapedChars(m.backslash, &prevEscaped))
+	if *inString {
+		stringMask = ^stringMask
+	}
+
+	if m.backslash&^stringMask != 0 || m.control&stringMask != 0 {
+		return 0, false, false
+	}
+
+	whitespace := m.space &^ stringMask
+	for c := m.control &^ stringMask; c != 0; c &= c - 1 {
+		i := bits.TrailingZeros64(c)
+		switch block[i] {
+		case TAB, LF, CR:
+			whitespace |= 1 << uint(i)
+		case 0:
+			return 0, false, false
+		}
+	}
+
+	end := blockSize
+	for s := (m.open | m.close) &^ stringMask; s != 0; s &= s - 1 {
+		i := bits.TrailingZeros64(s)
+		ch := block[i]
+
+		// mismatched closing brackets are ignored, as they are when scanning a byte at a time
+		top := p.openStack.Peek()
+		if top == 0 && ch == closeCh {
+			end = i + 1
+			closed = true
+			break
+		} else if ch == OpenCB || ch == OpenSB {
+			p.openStack.Push(ch)
+		} else if (top == OpenCB && ch == CloseCB) || (top == OpenSB && ch == CloseSB) {
+			p.openStack.Pop()
+		}
+	}
+
+	if closed {
+		whitespace &= lowBits(end)
+	}
+
+	if p.ControlChars == ControlCharPreserve {
+		whitespace = 0
+	}
+
+	// copy the runs of bytes between the runs of whitespace
+	start := 0
+	for whitespace != 0 {
+		i := bits.TrailingZeros64(whitespace)
+		run := bits.TrailingZeros64(^(whitespace >> uint(i)))
+		p.objBuf = append(p.objBuf, block[start:i]...)
+		start = i + run
+		if start >= end {
+			break
+		}
+
+		whitespace &^= lowBits(start)
+	}
+
+	if start < end {
+		p.objBuf = append(p.objBuf, block[start:end]...)
+	}
+
+	*inString = stringMask>>63 != 0
+	*escaped = prevEscaped != 0
+	return end, closed, true
+}
@@ -0,0 +1,218 @@
+package jsplit
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// structuralTestBytes are the bytes random blocks and documents are made from, weighted towards the bytes the index
+// treats specially
+var structuralTestBytes = []byte("{}[]\"\"\"\\\\\\  \t\r\n,:ab1\x00\x01\x1f\x7b\x7d\x5b\x5d\x80\xdb\xdd\xfb\xfd\xa0\xff\x7f")
+
+func randomBlock(rng *rand.Rand) []byte {
+	block := make([]byte, blockSize)
+	for i := range block {
+		block[i] = structuralTestBytes[rng.Intn(len(structuralTestBytes))]
+	}
+
+	return block
+}
+
+func TestClassifyBlock(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 1000; n++ {
+		block := randomBlock(rng)
+
+		var expected blockMasks
+		for i, ch := range block {
+			bit := uint64(1) << uint(i)
+			if ch == QM {
+				expected.quote |= bit
+			}
+			if ch == Escape {
+				expected.backslash |= bit
+			}
+			if ch < 0x20 {
+				expected.control |= bit
+			}
+			if ch == SPACE {
+				expected.space |= bit
+			}
+			if ch == OpenCB || ch == OpenSB {
+				expected.open |= bit
+			}
+			if ch == CloseCB || ch == CloseSB {
+				expected.close |= bit
+			}
+		}
+
+		require.Equal(t, expected, classifyBlock(block), "%q", block)
+
+		stringMasks := classifyStringBlock(block)
+		require.Equal(t, expected.quote, stringMasks.quote)
+		require.Equal(t, expected.backslash, stringMasks.backslash)
+		require.Equal(t, expected.control, stringMasks.control)
+	}
+}
+
+func TestEscapedChars(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for n := 0; n < 1000; n++ {
+		// runs of backslashes spanning blocks carry from one block to the next
+		var prevEscaped uint64
+		escaped := false
+		for b := 0; b < 4; b++ {
+			backslash := rng.Uint64() | rng.Uint64()
+
+			var expected uint64
+			for i := 0; i < blockSize; i++ {
+				bit := uint64(1) << uint(i)
+				if escaped {
+					expected |= bit
+					escaped = false
+				} else if backslash&bit != 0 {
+					escaped = true
+				}
+			}
+
+			require.Equal(t, expected, escapedChars(backslash, &prevEscaped), "%064b", backslash)
+			require.Equal(t, escaped, prevEscaped != 0)
+		}
+	}
+}
+
+// randomDoc generates a json like document of roughly the supplied size.  When valid is false it also contains
+// mismatched brackets, backslashes outside of strings, raw control characters and 0 bytes.
+func randomDoc(rng *rand.Rand, size int, valid bool) []byte {
+	var buf bytes.Buffer
+	var value func(depth int)
+	str := func() {
+		buf.WriteByte(QM)
+		n := rng.Intn(200)
+		for i := 0; i < n; i++ {
+			switch r := rng.Intn(20); {
+			case r == 0:
+				buf.WriteString(`\\`)
+			case r == 1:
+				buf.WriteString(`\"`)
+			case r == 2 && !valid:
+				buf.WriteByte(structuralTestBytes[rng.Intn(len(structuralTestBytes))])
+			case r == 3:
+				buf.WriteString("]}[{ é")
+			default:
+				buf.WriteByte(byte('a' + rng.Intn(26)))
+			}
+		}
+		buf.WriteByte(QM)
+	}
+	ws := func() {
+		buf.WriteString([]string{"", "", " ", "\n\t\t", "\r\n    "}[rng.Intn(5)])
+	}
+	value = func(depth int) {
+		ws()
+		switch r := rng.Intn(10); {
+		case r < 3 && depth < 8 && buf.Len() < size:
+			buf.WriteByte(OpenCB)
+			n := rng.Intn(6)
+			for i := 0; i < n; i++ {
+				if i > 0 {
+					buf.WriteByte(COMMA)
+				}
+				ws()
+				str()
+				ws()
+				buf.WriteByte(COLON)
+				value(depth + 1)
+			}
+			ws()
+			buf.WriteByte(CloseCB)
+		case r < 6 && depth < 8 && buf.Len() < size:
+			buf.WriteByte(OpenSB)
+			n := rng.Intn(6)
+			for i := 0; i < n; i++ {
+				if i > 0 {
+					buf.WriteByte(COMMA)
+				}
+				value(depth + 1)
+			}
+			ws()
+			buf.WriteByte(CloseSB)
+		case r < 8:
+			str()
+		case r == 8 && !valid:
+			buf.WriteByte(structuralTestBytes[rng.Intn(len(structuralTestBytes))])
+		default:
+			buf.WriteString(strconv.Itoa(rng.Intn(100000)))
+		}
+		ws()
+	}
+
+	buf.WriteByte(OpenSB)
+	for i := 0; buf.Len() < size; i++ {
+		if i > 0 {
+			buf.WriteByte(COMMA)
+		}
+		value(0)
+	}
+	buf.WriteByte(CloseSB)
+
+	return buf.Bytes()
+}
+
+// parseResult is the outcome of parsing a document with ParseObject followed by ParseList, used to compare the
+// structural index to scanning a byte at a time
+type parseResult struct {
+	object string
+	items  []string
+	err    string
+}
+
+func parseWith(p *Parser, doc []byte, readSize int) parseResult {
+	var res parseResult
+	obj, err := p.ParseObject(NewBufferedStreamIter(NewTestByteStream(doc, readSize), context.Background()))
+	if err != nil {
+		res.err = err.Error()
+	}
+	res.object = string(obj)
+
+	err = p.ParseList(NewBufferedStreamIter(NewTestByteStream(doc, readSize), context.Background()), func(item []byte) error {
+		res.items = append(res.items, string(item))
+		return nil
+	})
+	if err != nil {
+		res.err += " / " + err.Error()
+	}
+
+	return res
+}
+
+func TestStructuralIndexMatchesByteScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+
+	var docs [][]byte
+	for _, doc := range fuzzSeedDocs {
+		docs = append(docs, []byte(doc))
+	}
+
+	for i := 0; i < 50; i++ {
+		doc := randomDoc(rng, 256+rng.Intn(4096), i%2 == 0)
+		docs = append(docs, doc)
+		// truncated documents end within a block
+		docs = append(docs, doc[:rng.Intn(len(doc))])
+	}
+
+	for _, mode := range []ControlCharMode{ControlCharEscape, ControlCharPreserve, ControlCharReject} {
+		for _, readSize := range []int{7, 64, 100, 1 << 20} {
+			for _, doc := range docs {
+				expected := parseWith(&Parser{ControlChars: mode, noIndex: true}, doc, readSize)
+				actual := parseWith(&Parser{ControlChars: mode}, doc, readSize)
+				require.Equal(t, expected, actual, "mode: %s readSize: %d doc: %q", mode, readSize, doc)
+			}
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package jsplit
+
+import (
+	"fmt"
+	"strings"
+)
+
+// snippetRadius is the number of bytes either side of an error included in a SyntaxError's snippet
+const snippetRadius = 24
+
+// SyntaxError describes malformed json found while parsing a stream
+type SyntaxError struct {
+	// Msg describes the problem
+	Msg string
+	// Position is the location in the stream of the byte where the problem was found
+	Position
+	// Path is a JSON Pointer to the value being parsed when the problem was found, or an empty string if the problem is
+	// in the root of the document. Paths identify the key or list index being parsed, they do not extend inside list
+	// items or the values of keys which are not being split.
+	Path string
+	// Snippet contains the bytes surrounding the problem which are still buffered
+	Snippet []byte
+
+	// segments holds the path in reverse order as segments are added while the error is returned up the stack
+	segments []string
+}
+
+// newSyntaxError returns a *SyntaxError for a problem found at the current position of the iterator.  If ch is not 0
+// it is the offending byte, and has already been consumed from the iterator.
+func newSyntaxError(itr *BufferedByteStreamIter, ch byte, format string, args ...interface{}) *SyntaxError {
+	i := itr.pos
+	if ch != 0 && i > 0 {
+		i--
+	}
+
+	return &SyntaxError{
+		Msg:      fmt.Sprintf(format, args...),
+		Position: itr.positionOf(i),
+		Snippet:  append([]byte(nil), itr.surrounding(i, snippetRadius)...),
+	}
+}
+
+// Error returns a description of the error including its location
+func (se *SyntaxError) Error() string {
+	var sb strings.Builder
+	if se.Line > 0 {
+		fmt.Fprintf(&sb, "syntax error at line %d, column %d (offset %d)", se.Line, se.Column, se.Offset)
+	} else {
+		fmt.Fprintf(&sb, "syntax error at offset %d", se.Offset)
+	}
+
+	if len(se.Path) > 0 {
+		fmt.Fprintf(&sb, " in %s", se.Path)
+	}
+
+	fmt.Fprintf(&sb, ": %s", se.Msg)
+
+	if len(se.Snippet) > 0 {
+		fmt.Fprintf(&sb, " near %q", se.Snippet)
+	}
+
+	return sb.String()
+}
+
+// withPathSegment adds a key or list index to the front of the path of a *SyntaxError.  Other errors are returned
+// unchanged.
+func withPathSegment(err error, segment string) error {
+	se, ok := err.(*SyntaxError)
+	if !ok {
+		return err
+	}
+
+	se.segments = append(se.segments, segment)
+	se.updatePath()
+
+	return se
+}
+
+// updatePath sets Path from the segments of the path
+func (se *SyntaxError) updatePath() {
+	var sb strings.Builder
+	for i := len(se.segments) - 1; i >= 0; i-- {
+		sb.WriteByte('/')
+		sb.WriteString(strings.ReplaceAll(strings.ReplaceAll(se.segments[i], "~", "~0"), "/", "~1"))
+	}
+	se.Path = sb.String()
+}
+
+// describeByte formats a byte for use in an error message
+func describeByte(ch byte) string {
+	if ch == 0 {
+		return "EOF"
+	}
+
+	return fmt.Sprintf("%q", rune(ch))
+}
@@ -0,0 +1,85 @@
+package jsplit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyntaxError(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		msg      string
+		position Position
+		path     string
+	}{
+		{
+			name:     "invalid root",
+			doc:      "\n\n  true",
+			msg:      "invalid format. Only json objects and lists are supported, found 't'",
+			position: Position{4, 3, 3},
+		},
+		{
+			name:     "missing colon",
+			doc:      "{\n\t\"key\" 1\n}",
+			msg:      "expected ':' found '1'",
+			position: Position{9, 2, 8},
+		},
+		{
+			name:     "missing comma in list",
+			doc:      "{\n\t\"list\": [1, {} 3]\n}",
+			msg:      "unexpected '3' found. Expecting ',' or ']'",
+			position: Position{18, 2, 17},
+			path:     "/list",
+		},
+		{
+			name:     "unterminated item",
+			doc:      "{\"a\": 1, \"list\": [{}, {\"k\": [1, 2]",
+			msg:      "unexpected EOF found while parsing object",
+			position: Position{34, 1, 35},
+			path:     "/list/1",
+		},
+		{
+			name:     "missing comma in nested object",
+			doc:      "{\"a~b\": {\"c\": {\"d\": [1] \"e\": 1}}}",
+			msg:      "unexpected '\"' found. Expecting ',' or '}'",
+			position: Position{24, 1, 25},
+			path:     "/a~0b/c",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := SplitterOptions{OutputDir: t.TempDir(), Paths: []string{"/a~0b/c/d", "/list"}}
+			opts.setDefaults()
+
+			err := splitStream(context.Background(), NewTestByteStream([]byte(test.doc), 4), opts)
+			require.Error(t, err)
+
+			var se *SyntaxError
+			require.True(t, errors.As(err, &se), err.Error())
+			require.Equal(t, test.msg, se.Msg)
+			require.Equal(t, test.position, se.Position)
+			require.Equal(t, test.path, se.Path)
+			require.Contains(t, se.Error(), test.msg)
+		})
+	}
+}
+
+func TestSyntaxErrorMessage(t *testing.T) {
+	itr := NewTestItr(`{"key": 1 "next": 2}`)
+	for i := 0; i < 11; i++ {
+		itr.Next()
+	}
+
+	se := newSyntaxError(itr, '"', "unexpected %s", describeByte('"'))
+	require.Equal(t, Position{10, 1, 11}, se.Position)
+	require.Equal(t, `syntax error at line 1, column 11 (offset 10): unexpected '"' near "{\"key\": 1 \"next\": 2}"`, se.Error())
+
+	err := withPathSegment(se, "0")
+	err = withPathSegment(err, "list")
+	require.Equal(t, `syntax error at line 1, column 11 (offset 10) in /list/0: unexpected '"' near "{\"key\": 1 \"next\": 2}"`, err.Error())
+}
@@ -0,0 +1,136 @@
+package jsplit
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// InvalidUTF8Mode controls how items containing bytes which are not valid UTF-8 are handled
+type InvalidUTF8Mode string
+
+const (
+	// InvalidUTF8Ignore writes items without checking that they are valid UTF-8
+	InvalidUTF8Ignore InvalidUTF8Mode = "ignore"
+	// InvalidUTF8Fail stops splitting with an *InvalidUTF8Error at the first invalid item
+	InvalidUTF8Fail InvalidUTF8Mode = "fail"
+	// InvalidUTF8Replace replaces each invalid byte with the unicode replacement character U+FFFD
+	InvalidUTF8Replace InvalidUTF8Mode = "replace"
+	// InvalidUTF8Reject writes invalid items unchanged to [key]_rejects_%02d.jsonl rather than the list's jsonl files
+	InvalidUTF8Reject InvalidUTF8Mode = "reject"
+)
+
+// ParseInvalidUTF8Mode returns the InvalidUTF8Mode with the supplied name. An empty name returns InvalidUTF8Ignore
+func ParseInvalidUTF8Mode(name string) (InvalidUTF8Mode, error) {
+	switch m := InvalidUTF8Mode(strings.ToLower(name)); m {
+	case "":
+		return InvalidUTF8Ignore, nil
+	case InvalidUTF8Ignore, InvalidUTF8Fail, InvalidUTF8Replace, InvalidUTF8Reject:
+		return m, nil
+	}
+
+	return "", fmt.Errorf("unknown invalid utf-8 mode '%s'", name)
+}
+
+// InvalidUTF8Error is returned when an item being split contains bytes which are not valid UTF-8 and the
+// InvalidUTF8Fail mode is in use
+type InvalidUTF8Error struct {
+	// List is the name of the list containing the item
+	List string
+	// Item is the index of the item within the list
+	Item int
+	// Offset is the offset within the item of the first invalid byte
+	Offset int
+}
+
+// Error returns a description of the error including the location of the invalid item
+func (e *InvalidUTF8Error) Error() string {
+	return fmt.Sprintf("invalid utf-8 in item %d of %s at byte %d of the item", e.Item, e.List, e.Offset)
+}
+
+// utf8Checker checks the items of a list are valid UTF-8 before passing them on to be written
+type utf8Checker struct {
+	mode    InvalidUTF8Mode
+	list    string
+	add     ListAddFunc
+	rejects *SplittingJsonlWriter
+	items   int
+}
+
+// Add checks an item and handles it according to the checker's mode
+func (uc *utf8Checker) Add(item []byte) error {
+	idx := uc.items
+	uc.items++
+
+	offset := invalidUTF8Offset(item)
+	if offset == -1 {
+		return uc.add(item)
+	}
+
+	switch uc.mode {
+	case InvalidUTF8Replace:
+		return uc.add(replaceInvalidUTF8(item, offset))
+	case InvalidUTF8Reject:
+		return uc.rejects.Add(item)
+	}
+
+	return &InvalidUTF8Error{List: uc.list, Item: idx, Offset: offset}
+}
+
+// Close closes the rejects file if one was written
+func (uc *utf8Checker) Close() error {
+	if uc.rejects == nil {
+		return nil
+	}
+
+	return uc.rejects.Close()
+}
+
+// invalidUTF8Offset returns the offset of the first byte of data which is not valid UTF-8, or -1 if it is all valid
+func invalidUTF8Offset(data []byte) int {
+	if utf8.Valid(data) {
+		return -1
+	}
+
+	for i := 0; i < len(data); {
+		if data[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+
+		i += size
+	}
+
+	return -1
+}
+
+// replaceInvalidUTF8 returns a copy of data with each byte which is not valid UTF-8 replaced by U+FFFD.  Everything
+// before offset is known to be valid.
+func replaceInvalidUTF8(data []byte, offset int) []byte {
+	replaced := make([]byte, offset, len(data)+2*utf8.UTFMax)
+	copy(replaced, data[:offset])
+
+	for i := offset; i < len(data); {
+		if data[i] < utf8.RuneSelf {
+			replaced = append(replaced, data[i])
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			replaced = utf8.AppendRune(replaced, utf8.RuneError)
+		} else {
+			replaced = append(replaced, data[i:i+size]...)
+		}
+
+		i += size
+	}
+
+	return replaced
+}
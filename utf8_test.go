@@ -0,0 +1,101 @@
+package jsplit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInvalidUTF8Mode(t *testing.T) {
+	mode, err := ParseInvalidUTF8Mode("")
+	require.NoError(t, err)
+	require.Equal(t, InvalidUTF8Ignore, mode)
+
+	mode, err = ParseInvalidUTF8Mode("Replace")
+	require.NoError(t, err)
+	require.Equal(t, InvalidUTF8Replace, mode)
+
+	_, err = ParseInvalidUTF8Mode("drop")
+	require.Error(t, err)
+}
+
+func TestReplaceInvalidUTF8(t *testing.T) {
+	tests := []struct {
+		data     string
+		offset   int
+		expected string
+	}{
+		{"valid é 😀", -1, "valid é 😀"},
+		{"caf\xe9", 3, "caf�"},
+		{"\xe9\xe8 é", 0, "�� é"},
+		{"truncated \xf0\x9f\x98", 10, "truncated ���"},
+		{"\"na\xefve\":\"\xc0\xaf\"", 3, "\"na�ve\":\"��\""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			offset := invalidUTF8Offset([]byte(test.data))
+			require.Equal(t, test.offset, offset)
+
+			if offset != -1 {
+				require.Equal(t, test.expected, string(replaceInvalidUTF8([]byte(test.data), offset)))
+			}
+		})
+	}
+}
+
+func TestSplitStreamInvalidUTF8(t *testing.T) {
+	const doc = "{\"name\": \"caf\xe9\", \"list\": [{\"a\": \"ok\"}, {\"a\": \"caf\xe9\"}, \"na\xefve\", 3]}"
+
+	split := func(t *testing.T, mode InvalidUTF8Mode) (string, error) {
+		dir := t.TempDir()
+		opts := SplitterOptions{OutputDir: dir, InvalidUTF8: mode}
+		opts.setDefaults()
+		return dir, splitStream(context.Background(), NewTestByteStream([]byte(doc), 7), opts)
+	}
+
+	t.Run("ignore", func(t *testing.T) {
+		dir, err := split(t, InvalidUTF8Ignore)
+		require.NoError(t, err)
+		requireContents(t, filepath.Join(dir, "list_00.jsonl"), "{\"a\":\"ok\"}\n{\"a\":\"caf\xe9\"}\n\"na\xefve\"\n3")
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		_, err := split(t, InvalidUTF8Fail)
+		require.Error(t, err)
+
+		var utf8Err *InvalidUTF8Error
+		require.True(t, errors.As(err, &utf8Err))
+		require.Equal(t, InvalidUTF8Error{List: "list", Item: 1, Offset: 9}, *utf8Err)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		dir, err := split(t, InvalidUTF8Replace)
+		require.NoError(t, err)
+		requireContents(t, filepath.Join(dir, "list_00.jsonl"), "{\"a\":\"ok\"}\n{\"a\":\"caf�\"}\n\"na�ve\"\n3")
+		requireContents(t, filepath.Join(dir, "root.json"), "{\n\t\"name\":\"caf\xe9\"\n}")
+	})
+
+	t.Run("reject", func(t *testing.T) {
+		dir, err := split(t, InvalidUTF8Reject)
+		require.NoError(t, err)
+		requireContents(t, filepath.Join(dir, "list_00.jsonl"), "{\"a\":\"ok\"}\n3")
+		requireContents(t, filepath.Join(dir, "list_rejects_00.jsonl"), "{\"a\":\"caf\xe9\"}\n\"na\xefve\"")
+	})
+
+	t.Run("no rejects file for valid items", func(t *testing.T) {
+		dir := t.TempDir()
+		opts := SplitterOptions{OutputDir: dir, InvalidUTF8: InvalidUTF8Reject}
+		opts.setDefaults()
+		err := splitStream(context.Background(), NewTestByteStream([]byte(`{"list": ["é", 2]}`), 7), opts)
+		require.NoError(t, err)
+
+		requireContents(t, filepath.Join(dir, "list_00.jsonl"), "\"é\"\n2")
+		_, err = os.Stat(filepath.Join(dir, "list_rejects_00.jsonl"))
+		require.True(t, os.IsNotExist(err))
+	})
+}
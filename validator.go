@@ -0,0 +1,328 @@
+package jsplit
+
+// validatorState is the state of a validator's state machine
+type validatorState int
+
+const (
+	// vsValue expects the start of a value
+	vsValue validatorState = iota
+	// vsValueOrClose expects the start of a value or the end of an empty list
+	vsValueOrClose
+	// vsKeyOrClose expects a key or the end of an empty object
+	vsKeyOrClose
+	// vsKey expects a key
+	vsKey
+	// vsColon expects the colon following a key
+	vsColon
+	// vsAfterValue expects a comma or the end of the enclosing object or list
+	vsAfterValue
+	// vsDone is reached once a complete value has been validated
+	vsDone
+	vsString
+	vsStringEscape
+	vsStringHex
+	vsNumMinus
+	vsNumZero
+	vsNumInt
+	vsNumDot
+	vsNumFrac
+	vsNumExp
+	vsNumExpSign
+	vsNumExpDigits
+	vsLiteral
+)
+
+var validatorLiterals = map[byte]string{
+	't': "true",
+	'f': "false",
+	'n': "null",
+}
+
+// validator validates that a sequence of bytes is a single json value as defined by RFC 8259.  Bytes are supplied one
+// at a time allowing validation to take place while the bytes are being scanned by the parser.
+type validator struct {
+	state validatorState
+	stack []byte
+
+	// inKey is true while validating a string which is an object key
+	inKey bool
+	// hexRemaining is the number of hex digits remaining in a \u escape sequence
+	hexRemaining int
+	// literal and literalPos track progress through the literal true, false or null
+	literal    string
+	literalPos int
+}
+
+// reset prepares the validator to validate a new value
+func (v *validator) reset() {
+	v.state = vsValue
+	v.stack = v.stack[:0]
+	v.inKey = false
+}
+
+// step validates the next byte returning a description of the problem if it is invalid, or an empty string if it is
+// valid
+func (v *validator) step(ch byte) string {
+	switch v.state {
+	case vsValue, vsValueOrClose:
+		if isWhitespace[ch] {
+			return ""
+		} else if ch == CloseSB && v.state == vsValueOrClose {
+			return v.closeContainer(ch)
+		}
+
+		return v.startValue(ch)
+
+	case vsKeyOrClose, vsKey:
+		if isWhitespace[ch] {
+			return ""
+		} else if ch == CloseCB && v.state == vsKeyOrClose {
+			return v.closeContainer(ch)
+		} else if ch == QM {
+			v.state = vsString
+			v.inKey = true
+			return ""
+		}
+
+		return "expected a string key found " + describeByte(ch)
+
+	case vsColon:
+		if isWhitespace[ch] {
+			return ""
+		} else if ch == COLON {
+			v.state = vsValue
+			return ""
+		}
+
+		return "expected ':' found " + describeByte(ch)
+
+	case vsAfterValue:
+		return v.afterValue(ch)
+
+	case vsDone:
+		if isWhitespace[ch] {
+			return ""
+		}
+
+		return "unexpected " + describeByte(ch) + " after the end of the value"
+
+	case vsString:
+		switch {
+		case ch == QM:
+			if v.inKey {
+				v.inKey = false
+				v.state = vsColon
+			} else {
+				v.endValue()
+			}
+		case ch == Escape:
+			v.state = vsStringEscape
+		case ch < 0x20:
+			return "invalid control character " + describeByte(ch) + " in string"
+		}
+
+		return ""
+
+	case vsStringEscape:
+		switch ch {
+		case QM, Escape, '/', 'b', 'f', 'n', 'r', 't':
+			v.state = vsString
+		case 'u':
+			v.state = vsStringHex
+			v.hexRemaining = 4
+		default:
+			return "invalid escape sequence '\\" + string(rune(ch)) + "' in string"
+		}
+
+		return ""
+
+	case vsStringHex:
+		if !isHex(ch) {
+			return "invalid character " + describeByte(ch) + " in \\u escape sequence"
+		}
+
+		v.hexRemaining--
+		if v.hexRemaining == 0 {
+			v.state = vsString
+		}
+
+		return ""
+
+	case vsNumMinus:
+		if ch == '0' {
+			v.state = vsNumZero
+		} else if isDigit(ch) {
+			v.state = vsNumInt
+		} else {
+			return "expected a digit after '-' found " + describeByte(ch)
+		}
+
+		return ""
+
+	case vsNumZero, vsNumInt:
+		if isDigit(ch) && v.state == vsNumInt {
+			return ""
+		} else if ch == '.' {
+			v.state = vsNumDot
+			return ""
+		} else if ch == 'e' || ch == 'E' {
+			v.state = vsNumExp
+			return ""
+		} else if isDigit(ch) {
+			return "invalid leading zero in number"
+		}
+
+		v.endValue()
+		return v.step(ch)
+
+	case vsNumDot:
+		if !isDigit(ch) {
+			return "expected a digit after '.' found " + describeByte(ch)
+		}
+
+		v.state = vsNumFrac
+		return ""
+
+	case vsNumFrac:
+		if isDigit(ch) {
+			return ""
+		} else if ch == 'e' || ch == 'E' {
+			v.state = vsNumExp
+			return ""
+		}
+
+		v.endValue()
+		return v.step(ch)
+
+	case vsNumExp:
+		if ch == '+' || ch == '-' {
+			v.state = vsNumExpSign
+			return ""
+		}
+
+		fallthrough
+
+	case vsNumExpSign:
+		if !isDigit(ch) {
+			return "expected a digit in exponent found " + describeByte(ch)
+		}
+
+		v.state = vsNumExpDigits
+		return ""
+
+	case vsNumExpDigits:
+		if isDigit(ch) {
+			return ""
+		}
+
+		v.endValue()
+		return v.step(ch)
+
+	case vsLiteral:
+		if ch != v.literal[v.literalPos] {
+			return "invalid character " + describeByte(ch) + " in literal " + v.literal
+		}
+
+		v.literalPos++
+		if v.literalPos == len(v.literal) {
+			v.endValue()
+		}
+
+		return ""
+	}
+
+	return "invalid validator state"
+}
+
+// end is called once all bytes have been supplied and returns a description of the problem if they did not form a
+// complete value
+func (v *validator) end() string {
+	switch v.state {
+	case vsNumZero, vsNumInt, vsNumFrac, vsNumExpDigits:
+		v.endValue()
+	}
+
+	if v.state != vsDone {
+		return "incomplete json value"
+	}
+
+	return ""
+}
+
+func (v *validator) startValue(ch byte) string {
+	switch {
+	case ch == OpenCB:
+		v.stack = append(v.stack, ch)
+		v.state = vsKeyOrClose
+	case ch == OpenSB:
+		v.stack = append(v.stack, ch)
+		v.state = vsValueOrClose
+	case ch == QM:
+		v.state = vsString
+	case ch == '-':
+		v.state = vsNumMinus
+	case ch == '0':
+		v.state = vsNumZero
+	case isDigit(ch):
+		v.state = vsNumInt
+	default:
+		literal, ok := validatorLiterals[ch]
+		if !ok {
+			return "unexpected " + describeByte(ch) + " found while looking for a value"
+		}
+
+		v.state = vsLiteral
+		v.literal = literal
+		v.literalPos = 1
+	}
+
+	return ""
+}
+
+func (v *validator) afterValue(ch byte) string {
+	if isWhitespace[ch] {
+		return ""
+	}
+
+	top := v.stack[len(v.stack)-1]
+	switch {
+	case ch == COMMA && top == OpenCB:
+		v.state = vsKey
+	case ch == COMMA:
+		v.state = vsValue
+	case ch == CloseCB || ch == CloseSB:
+		return v.closeContainer(ch)
+	default:
+		return "unexpected " + describeByte(ch) + " found after value. Expecting ',' or the end of the object or list"
+	}
+
+	return ""
+}
+
+func (v *validator) closeContainer(ch byte) string {
+	top := v.stack[len(v.stack)-1]
+	if (top == OpenCB && ch != CloseCB) || (top == OpenSB && ch != CloseSB) {
+		return "mismatched " + describeByte(ch) + " closing " + describeByte(top)
+	}
+
+	v.stack = v.stack[:len(v.stack)-1]
+	v.endValue()
+	return ""
+}
+
+// endValue transitions to the appropriate state after a complete value has been read
+func (v *validator) endValue() {
+	if len(v.stack) == 0 {
+		v.state = vsDone
+	} else {
+		v.state = vsAfterValue
+	}
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+func isHex(ch byte) bool {
+	return isDigit(ch) || (ch >= 'a' && ch <= 'f') || (ch >= 'A' && ch <= 'F')
+}
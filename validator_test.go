@@ -0,0 +1,82 @@
+package jsplit
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var validatorTestValues = []string{
+	`{}`,
+	`[]`,
+	` { "a" : [ 1 , 2 ] } `,
+	`{"a":{"b":{"c":[[],[{}],null]}}}`,
+	`"string"`,
+	`"escapes \" \\ \/ \b \f \n \r \t \u00e9 \uD83D\uDE00"`,
+	`"raw utf8 é 😀"`,
+	`0`,
+	`-0`,
+	`-12.5e+10`,
+	`1E5`,
+	`0.5`,
+	`true`,
+	`false`,
+	`null`,
+	`[1,2,3,]`,
+	`{"a":1,}`,
+	`[,1]`,
+	`{"a" 1}`,
+	`{"a":}`,
+	`{1:2}`,
+	`{'a':1}`,
+	`[1 2]`,
+	`[1}`,
+	`{"a":1]`,
+	`"unterminated`,
+	`"bad escape \x"`,
+	`"bad unicode \u12g4"`,
+	"\"raw newline \n\"",
+	"\"raw tab \t\"",
+	`01`,
+	`-`,
+	`1.`,
+	`.5`,
+	`1e`,
+	`1e+`,
+	`+1`,
+	`tru`,
+	`truex`,
+	`nul`,
+	`True`,
+	`NaN`,
+	`[1]]`,
+	`{}{}`,
+	``,
+	`   `,
+}
+
+func validate(s string) string {
+	var v validator
+	v.reset()
+	for i := 0; i < len(s); i++ {
+		if msg := v.step(s[i]); len(msg) != 0 {
+			return msg
+		}
+	}
+
+	return v.end()
+}
+
+func TestValidatorMatchesEncodingJson(t *testing.T) {
+	for _, val := range validatorTestValues {
+		t.Run(val, func(t *testing.T) {
+			msg := validate(val)
+			if json.Valid([]byte(val)) {
+				require.Empty(t, msg)
+			} else {
+				require.NotEmpty(t, msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package jsplit
+
+import (
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	zipLocalHeaderLen   = 30
+	zipFlagDataDesc     = 0x8
+	zipMethodStore      = 0
+	zipMethodDeflate    = 8
+	zipExtraZip64       = 0x0001
+	zipMaxUint32        = 0xffffffff
+	zipLocalHeaderMagic = 0x04034b50
+)
+
+// newZipEntryReader returns an io.ReadCloser which reads the first entry of a zip archive.  archive/zip requires an
+// io.ReaderAt, so the local file header is parsed directly allowing archives to be read from non-seekable streams.
+func newZipEntryReader(rd io.Reader) (io.ReadCloser, error) {
+	hdr := make([]byte, zipLocalHeaderLen)
+	_, err := io.ReadFull(rd, hdr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip header: %w", err)
+	}
+
+	if binary.LittleEndian.Uint32(hdr[0:4]) != zipLocalHeaderMagic {
+		return nil, errors.New("invalid zip local file header")
+	}
+
+	flags := binary.LittleEndian.Uint16(hdr[6:8])
+	method := binary.LittleEndian.Uint16(hdr[8:10])
+	compressedSize := uint64(binary.LittleEndian.Uint32(hdr[18:22]))
+	nameLen := int(binary.LittleEndian.Uint16(hdr[26:28]))
+	extraLen := int(binary.LittleEndian.Uint16(hdr[28:30]))
+
+	nameAndExtra := make([]byte, nameLen+extraLen)
+	_, err = io.ReadFull(rd, nameAndExtra)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip header: %w", err)
+	}
+
+	if compressedSize == zipMaxUint32 {
+		compressedSize = zip64CompressedSize(nameAndExtra[nameLen:], compressedSize)
+	}
+
+	switch method {
+	case zipMethodDeflate:
+		// deflate streams are self terminating so the size is not needed
+		return flate.NewReader(rd), nil
+
+	case zipMethodStore:
+		if flags&zipFlagDataDesc != 0 {
+			return nil, errors.New("streaming zip entries which are stored without compression are not supported")
+		}
+
+		return io.NopCloser(io.LimitReader(rd, int64(compressedSize))), nil
+	}
+
+	return nil, fmt.Errorf("unsupported zip compression method %d", method)
+}
+
+// zip64CompressedSize reads the compressed size from the zip64 extended information in a local file header's extra
+// field.  If it is not present the supplied default is returned.
+func zip64CompressedSize(extra []byte, def uint64) uint64 {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+
+		// the local header zip64 record contains the uncompressed size followed by the compressed size
+		if id == zipExtraZip64 && size >= 16 {
+			return binary.LittleEndian.Uint64(extra[8:16])
+		}
+
+		extra = extra[size:]
+	}
+
+	return def
+}